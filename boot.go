@@ -1,54 +1,253 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"strings"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/tueftler/boot/addr"
 	"github.com/tueftler/boot/command"
 	"github.com/tueftler/boot/events"
 	"github.com/tueftler/boot/output"
+	"github.com/tueftler/boot/policy"
 	"github.com/tueftler/boot/proxy"
+	"github.com/tueftler/boot/state"
 )
 
-// Intercept start event, running and waiting for boot command
-func start(log *output.Stream, client *docker.Client, event *docker.APIEvents) events.Action {
-	stream := log.Prefixed(output.Text("container", event.Actor.ID[0:13]+" | "))
+type config struct {
+	timeout      time.Duration
+	onTimeout    string
+	onFailure    string
+	maxRestarts  int
+	afterTimeout time.Duration
+	drainTimeout time.Duration
+	running      bool
+	buffer       int
+	policy       string
+	access       string
+	hide         bool
+	state        *state.Registry
+}
+
+// Resolve a named action for a given event, dropping it by default. Once
+// a container has been restarted the maximum number of times given by the
+// "boot.max-restarts" label, it is stopped instead.
+func (c *config) resolve(name string, stream *output.Stream, container *docker.Container, event *docker.APIEvents) events.Action {
+	switch name {
+	case "emit":
+		return &events.Emit{Event: event}
+
+	case "stop":
+		return &events.Stop{Event: event, Log: stream}
+
+	case "kill":
+		return &events.Kill{Event: event, Log: stream}
+
+	case "restart":
+		max, err := command.Int(container, "boot.max-restarts", c.maxRestarts)
+		if err != nil {
+			stream.Error("Label error %s", err.Error())
+			return &events.Stop{Event: event, Log: stream}
+		} else if c.state.Restart(container.ID) > max {
+			stream.Warning("Restarted %d time(s) already, giving up", max)
+			return &events.Stop{Event: event, Log: stream}
+		}
+		return &events.Restart{Event: event, Log: stream}
+
+	default:
+		return &events.Drop{}
+	}
+}
+
+// Create a context which is done after the given timeout, if any
+func deadline(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// Record a container as ready and return the action emitting its start
+// event followed by "boot:ready"
+func (c *config) succeed(event *docker.APIEvents, attempts, exitCode int) events.Action {
+	duration := c.state.Finish(event.Actor.ID, state.READY, attempts, exitCode, "")
+	return &events.Ready{Event: event, Attempts: attempts, ExitCode: exitCode, Duration: duration}
+}
+
+// Record a container as failed and return the action emitting "boot:failed",
+// then performing the given action, e.g. emitting the start event anyway
+func (c *config) fail(event *docker.APIEvents, action events.Action, attempts, exitCode int, reason string) events.Action {
+	duration := c.state.Finish(event.Actor.ID, state.FAILED, attempts, exitCode, reason)
+	return &events.Failed{Event: event, Attempts: attempts, ExitCode: exitCode, Duration: duration, Reason: reason, Then: action}
+}
+
+// Create a stream for output concerning the given event's container
+func (c *config) stream(log *output.Stream, event *docker.APIEvents) *output.Stream {
+	return log.Prefixed(output.Text("container", event.Actor.ID[0:13]+" | ")).Tee(c.state.Output(event.Actor.ID))
+}
 
+// Intercept start event, emitting "boot:start" before waiting for the
+// containers given in "boot.after" if necessary, then running and waiting
+// for boot command
+func (c *config) start(log *output.Stream, client *docker.Client, event *docker.APIEvents) events.Action {
+	c.state.Pending(event.Actor.ID, event.Actor.Attributes["name"])
+	stream := c.stream(log, event)
+
+	return &events.Booting{Event: event, Then: func() events.Action {
+		return c.prepare(stream, client, event)
+	}}
+}
+
+// Inspect container and wait for the containers given in "boot.after"
+func (c *config) prepare(stream *output.Stream, client *docker.Client, event *docker.APIEvents) events.Action {
 	container, err := client.InspectContainer(event.Actor.ID)
 	if err != nil {
 		stream.Error("Inspect error %s", err.Error())
-		return &events.Drop{}
+		return c.fail(event, &events.Drop{}, 0, command.NOTRUN, err.Error())
 	}
 
-	boot := command.Boot(client, container)
-	stream.Info("Using boot command %s", boot)
-	result, err := boot.Run(stream)
+	after := command.List(container, "boot.after")
+	if len(after) == 0 {
+		return c.boot(stream, client, container, event)
+	}
+
+	timeout, err := command.Duration(container, "boot.after-timeout", c.afterTimeout)
+	if err != nil {
+		stream.Error("Label error %s", err.Error())
+		return c.fail(event, &events.Drop{}, 0, command.NOTRUN, err.Error())
+	}
+
+	return &events.After{Event: event, Log: stream, Depends: after, Timeout: timeout, Then: func(err error) events.Action {
+		if err != nil {
+			return c.fail(event, &events.Drop{}, 0, command.NOTRUN, err.Error())
+		}
+		return c.boot(stream, client, container, event)
+	}}
+}
+
+// Run and wait for boot command
+func (c *config) boot(stream *output.Stream, client *docker.Client, container *docker.Container, event *docker.APIEvents) events.Action {
+	timeout, err := command.Duration(container, "boot.timeout", c.timeout)
+	if err != nil {
+		stream.Error("Label error %s", err.Error())
+		return c.fail(event, &events.Drop{}, 0, command.NOTRUN, err.Error())
+	}
+
+	ctx, cancel := deadline(timeout)
+	defer cancel()
+
+	boot, err := command.Boot(client, container)
 	if err != nil {
+		stream.Error("Label error %s", err.Error())
+		return c.fail(event, &events.Drop{}, 0, command.NOTRUN, err.Error())
+	}
+
+	stream.Info("Using boot command %s", boot)
+	c.state.Booting(container.ID, boot.String())
+	result, err := boot.Run(ctx, stream)
+	attempts := command.Attempts(boot)
+	if ctx.Err() == context.DeadlineExceeded {
+		stream.Error("Timed out after %s", timeout)
+		action := c.resolve(command.Label(container, "boot.on-timeout", c.onTimeout), stream, container, event)
+		return c.fail(event, action, attempts, result, "Timed out after "+timeout.String())
+	} else if err != nil {
 		stream.Error("Run error %s", err.Error())
-		return &events.Drop{}
+		action := c.resolve(command.Label(container, "boot.on-failure", c.onFailure), stream, container, event)
+		return c.fail(event, action, attempts, result, err.Error())
 	}
 
 	switch result {
 	case command.NOTRUN:
 		stream.Warning("No boot command present, assuming container started")
-		return &events.Emit{Event: event}
+		return c.succeed(event, 0, result)
 
 	case 0:
 		stream.Success("Up and running!")
-		return &events.Emit{Event: event}
+		return c.succeed(event, attempts, result)
 
 	default:
 		stream.Error("Non-zero exit code %d", result)
-		return &events.Drop{}
+		action := c.resolve(command.Label(container, "boot.on-failure", c.onFailure), stream, container, event)
+		return c.fail(event, action, attempts, result, fmt.Sprintf("Non-zero exit code %d", result))
 	}
 }
 
+// Intercept an event by running the command given by a label, e.g.
+// "boot.drain", in the container if it is still running, telling clients
+// about it via the given lifecycle event first. The command's timeout is
+// read from the label suffixed with "-timeout". The event is passed on
+// once the command returns, regardless of its outcome.
+func (c *config) hook(label, lifecycle string, timeout time.Duration) events.Handler {
+	return func(log *output.Stream, client *docker.Client, event *docker.APIEvents) events.Action {
+		stream := c.stream(log, event)
+
+		container, err := client.InspectContainer(event.Actor.ID)
+		if err != nil {
+			stream.Error("Inspect error %s", err.Error())
+			return &events.Emit{Event: event}
+		} else if !container.State.Running {
+			return &events.Emit{Event: event}
+		}
+
+		hook, err := command.Labeled(client, container, label)
+		if err != nil {
+			stream.Error("Label error %s", err.Error())
+			return &events.Emit{Event: event}
+		} else if _, ok := hook.(*command.None); ok {
+			return &events.Emit{Event: event}
+		}
+
+		timeout, err := command.Duration(container, label+"-timeout", timeout)
+		if err != nil {
+			stream.Error("Label error %s", err.Error())
+			return &events.Emit{Event: event}
+		}
+
+		return &events.Announce{Event: event, Action: lifecycle, Then: func() events.Action {
+			ctx, cancel := deadline(timeout)
+			defer cancel()
+
+			stream.Info("Running %s command %s on %s", label, hook, event.Action)
+			result, err := hook.Run(ctx, stream)
+			if ctx.Err() == context.DeadlineExceeded {
+				stream.Error("Timed out after %s", timeout)
+			} else if err != nil {
+				stream.Error("Run error %s", err.Error())
+			} else if result != 0 {
+				stream.Error("Non-zero exit code %d", result)
+			}
+			return &events.Emit{Event: event}
+		}}
+	}
+}
+
+// Signals terminating a container, by number and name
+var terminating = map[string]bool{"2": true, "9": true, "15": true, "INT": true, "KILL": true, "TERM": true}
+
+// Intercept kill events only if they terminate the container, passing on
+// others, e.g. SIGHUP sent to reload configuration
+func terminate(handler events.Handler) events.Handler {
+	return func(log *output.Stream, client *docker.Client, event *docker.APIEvents) events.Action {
+		signal := strings.TrimPrefix(strings.ToUpper(event.Actor.Attributes["signal"]), "SIG")
+		if !terminating[signal] {
+			return &events.Emit{Event: event}
+		}
+		return handler(log, client, event)
+	}
+}
+
+// Intercept destroy event, forgetting about the container
+func (c *config) destroy(log *output.Stream, client *docker.Client, event *docker.APIEvents) events.Action {
+	c.state.Forget(event.Actor.ID)
+	return &events.Emit{Event: event}
+}
+
 // Graceful shutdown on Ctrl+C
 func wait(done chan bool) os.Signal {
 	sigs := make(chan os.Signal, 1)
@@ -66,7 +265,25 @@ func wait(done chan bool) os.Signal {
 }
 
 // Runs daemon
-func run(connect, listen addr.Addr) error {
+func run(connect, listen addr.Addr, boot *config) error {
+	switch boot.policy {
+	case events.DROP, events.DISCONNECT, events.BLOCK:
+	default:
+		return fmt.Errorf("Policy '%s': expected drop, disconnect or block", boot.policy)
+	}
+
+	if boot.buffer < 1 {
+		return fmt.Errorf("Buffer %d: must be at least 1", boot.buffer)
+	}
+
+	var rules []policy.Rule
+	if boot.access != "" {
+		var err error
+		if rules, err = policy.Named(boot.access); err != nil {
+			return fmt.Errorf("Access '%s': %s", boot.access, err.Error())
+		}
+	}
+
 	client, err := docker.NewClient(connect.String())
 	if err != nil {
 		return fmt.Errorf("Connect '%s': %s", connect, err.Error())
@@ -82,10 +299,27 @@ func run(connect, listen addr.Addr) error {
 		return fmt.Errorf("Listen '%s': %s", listen, err.Error())
 	}
 
+	handlers := map[string]events.Handler{
+		"start":   boot.start,
+		"kill":    terminate(boot.hook("boot.drain", "boot:drain", boot.drainTimeout)),
+		"destroy": boot.destroy,
+	}
 	events := events.Distribute(client, output.NewStream(output.Text("proxy", "distribute    | "), output.Print))
+	events.Listeners.Size = boot.buffer
+	events.Listeners.Policy = boot.policy
+	listing := proxy.Filter(events.Ready.Ready, func(id string) (interface{}, bool) {
+		container, ok := boot.state.Get(id)
+		return container, ok
+	})
 	proxy := proxy.Pass(connect, output.NewStream(output.Text("proxy", "proxy         | "), output.Print))
+	if boot.hide {
+		proxy.Rewrite = listing.Rewrite
+	}
+
+	boot.state = state.Record(20)
 
 	urls := http.NewServeMux()
+	urls.Handle("/_boot/containers", boot.state)
 	urls.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		if strings.HasSuffix(r.URL.Path, "/events") {
 			events.ServeHTTP(w, r)
@@ -93,12 +327,29 @@ func run(connect, listen addr.Addr) error {
 			proxy.ServeHTTP(w, r)
 		}
 	})
-	go http.Serve(server, urls)
+
+	handler := http.Handler(urls)
+	if rules != nil {
+		handler = policy.Allow(rules, urls, output.NewStream(output.Text("proxy", "policy        | "), output.Print))
+	}
+	go http.Serve(server, handler)
 
 	done := make(chan bool, 1)
-	events.Intercept("start", start)
+	for action, handler := range handlers {
+		events.Intercept(action, handler)
+	}
 	events.Log.Info("Listening...")
-	go events.Listen(done)
+	go events.Listen(time.Now(), done)
+
+	if boot.running {
+		known := func(id string) bool {
+			_, ok := boot.state.Get(id)
+			return ok
+		}
+		if err := events.Running(known); err != nil {
+			events.Log.Error("Listing running containers: %s", err.Error())
+		}
+	}
 
 	if sig := wait(done); sig != nil {
 		events.Log.Info("Received %s, shutting down", sig)
@@ -110,9 +361,21 @@ func run(connect, listen addr.Addr) error {
 func main() {
 	docker := flag.String("docker", "unix:///var/run/docker.sock", "Docker socket")
 	listen := flag.String("listen", "unix:///var/run/boot.sock", "Boot socket")
+	boot := &config{}
+	flag.DurationVar(&boot.timeout, "boot-timeout", 0, "Boot command timeout, 0 for none")
+	flag.StringVar(&boot.onTimeout, "boot-on-timeout", "drop", "Action on boot command timeout, drop, emit, stop, restart or kill")
+	flag.StringVar(&boot.onFailure, "boot-on-failure", "drop", "Action on boot command failure, drop, emit, stop, restart or kill")
+	flag.IntVar(&boot.maxRestarts, "boot-max-restarts", 3, "Maximum restarts of a container failing to boot")
+	flag.DurationVar(&boot.afterTimeout, "boot-after-timeout", 0, "Timeout waiting for dependencies, 0 for none")
+	flag.DurationVar(&boot.drainTimeout, "boot-drain-timeout", 10*time.Second, "Drain command timeout, 0 for none")
+	flag.BoolVar(&boot.running, "boot-running", true, "Boot containers already running at startup")
+	flag.IntVar(&boot.buffer, "events-buffer", 100, "Events queued per listener")
+	flag.StringVar(&boot.policy, "events-policy", events.DROP, "Action on full listener queue, drop, disconnect or block")
+	flag.StringVar(&boot.access, "access", "", "Access policy, read-only or a file with allowed requests, empty to allow all")
+	flag.BoolVar(&boot.hide, "hide-booting", false, "Hide containers not yet ready from container listings")
 	flag.Parse()
 
-	if err := run(addr.Flag(*docker), addr.Flag(*listen)); err != nil {
+	if err := run(addr.Flag(*docker), addr.Flag(*listen), boot); err != nil {
 		fmt.Println(err.Error())
 		os.Exit(1)
 	}
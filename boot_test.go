@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tueftler/boot/events"
+	"github.com/tueftler/boot/output"
+	"github.com/tueftler/boot/state"
+)
+
+const CONTAINER = "610036617aa165161127bc0cec60ae7831fdc1ddf1fdef1fb7f246cc83b0c315"
+
+func assertEqual(expect, actual interface{}, t *testing.T) {
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
+	}
+}
+
+func started() *docker.APIEvents {
+	return &docker.APIEvents{Action: "start", Actor: docker.APIActor{ID: CONTAINER}}
+}
+
+func Test_succeed(t *testing.T) {
+	boot := &config{state: state.Record(1)}
+	boot.state.Pending(CONTAINER, "/web")
+
+	action := boot.succeed(started(), 1, 0)
+	container, _ := boot.state.Get(CONTAINER)
+	assertEqual(state.READY, container.Status, t)
+	assertEqual(1, action.(*events.Ready).Attempts, t)
+}
+
+func Test_fail_emitting_anyway(t *testing.T) {
+	boot := &config{state: state.Record(1)}
+	boot.state.Pending(CONTAINER, "/web")
+	event := started()
+
+	action := boot.fail(event, &events.Emit{Event: event}, 3, 1, "Non-zero exit code 1")
+	container, _ := boot.state.Get(CONTAINER)
+	assertEqual(state.FAILED, container.Status, t)
+	assertEqual(1, action.(*events.Failed).ExitCode, t)
+	assertEqual(&events.Emit{Event: event}, action.(*events.Failed).Then, t)
+}
+
+func killed(signal string) *docker.APIEvents {
+	return &docker.APIEvents{Action: "kill", Actor: docker.APIActor{ID: CONTAINER, Attributes: map[string]string{"signal": signal}}}
+}
+
+func discard() *output.Stream {
+	return output.NewStream("", func(arg string) {})
+}
+
+// Starts a fake Docker daemon inspecting a container in the given state,
+// optionally labeled with a drain command polling the daemon itself.
+// Returns a client, a channel receiving drains and a function to stop.
+func draining(t *testing.T, running, labeled bool) (*docker.Client, chan bool, func()) {
+	drained := make(chan bool, 1)
+	var port string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/drain" {
+			drained <- true
+			return
+		}
+
+		labels := "{}"
+		if labeled {
+			labels = `{"boot.drain": "HTTP :` + port + `/drain"}`
+		}
+		fmt.Fprintf(w, `{"Id": "%s", "State": {"Running": %t}, "Config": {"Labels": %s}, "NetworkSettings": {"IPAddress": "127.0.0.1"}}`, CONTAINER, running, labels)
+	}))
+	_, port, _ = net.SplitHostPort(server.Listener.Addr().String())
+
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, drained, server.Close
+}
+
+func Test_terminate_passes_other_signals(t *testing.T) {
+	handler := terminate(func(log *output.Stream, client *docker.Client, event *docker.APIEvents) events.Action {
+		t.Errorf("Unexpected drain for %s", event.Actor.Attributes["signal"])
+		return &events.Drop{}
+	})
+
+	event := killed("SIGHUP")
+	assertEqual(&events.Emit{Event: event}, handler(discard(), nil, event), t)
+}
+
+func Test_terminate_drains(t *testing.T) {
+	handler := terminate(func(log *output.Stream, client *docker.Client, event *docker.APIEvents) events.Action {
+		return &events.Drop{}
+	})
+
+	for _, signal := range []string{"SIGTERM", "15", "TERM", "SIGKILL", "9", "SIGINT", "2"} {
+		assertEqual(&events.Drop{}, handler(discard(), nil, killed(signal)), t)
+	}
+}
+
+func Test_hook_passes_not_running(t *testing.T) {
+	client, drained, stop := draining(t, false, true)
+	defer stop()
+
+	boot := &config{state: state.Record(1)}
+	event := killed("SIGTERM")
+	assertEqual(&events.Emit{Event: event}, boot.hook("boot.drain", "boot:drain", 0)(discard(), client, event), t)
+	assertEqual(0, len(drained), t)
+}
+
+func Test_hook_passes_without_label(t *testing.T) {
+	client, drained, stop := draining(t, true, false)
+	defer stop()
+
+	boot := &config{state: state.Record(1)}
+	event := killed("SIGTERM")
+	assertEqual(&events.Emit{Event: event}, boot.hook("boot.drain", "boot:drain", 0)(discard(), client, event), t)
+	assertEqual(0, len(drained), t)
+}
+
+func Test_hook_announces_before_passing_on(t *testing.T) {
+	client, drained, stop := draining(t, true, true)
+	defer stop()
+
+	fixture := events.Distribute(client, discard())
+	subscription := fixture.Listeners.Subscribe()
+	boot := &config{state: state.Record(1)}
+	boot.hook("boot.drain", "boot:drain", time.Second)(discard(), client, killed("SIGTERM")).Do(fixture)
+
+	assertEqual(true, <-drained, t)
+	assertEqual("boot:drain", (<-subscription.Events).Action, t)
+	assertEqual("kill", (<-subscription.Events).Action, t)
+}
+
+func restarting(labels map[string]string) (*config, *docker.Container) {
+	boot := &config{maxRestarts: 1, state: state.Record(1)}
+	boot.state.Pending(CONTAINER, "/web")
+	return boot, &docker.Container{ID: CONTAINER, Config: &docker.Config{Labels: labels}}
+}
+
+func Test_resolve_restart(t *testing.T) {
+	boot, container := restarting(map[string]string{})
+	event := started()
+
+	action := boot.resolve("restart", discard(), container, event)
+	_, ok := action.(*events.Restart)
+	assertEqual(true, ok, t)
+	restarted, _ := boot.state.Get(CONTAINER)
+	assertEqual(1, restarted.Restarts, t)
+}
+
+func Test_resolve_restart_stops_at_maximum(t *testing.T) {
+	boot, container := restarting(map[string]string{})
+	event := started()
+	boot.resolve("restart", discard(), container, event)
+
+	action := boot.resolve("restart", discard(), container, event)
+	_, ok := action.(*events.Stop)
+	assertEqual(true, ok, t)
+}
+
+func Test_resolve_restart_with_label(t *testing.T) {
+	boot, container := restarting(map[string]string{"boot.max-restarts": "2"})
+	event := started()
+	boot.resolve("restart", discard(), container, event)
+
+	action := boot.resolve("restart", discard(), container, event)
+	_, ok := action.(*events.Restart)
+	assertEqual(true, ok, t)
+}
+
+func Test_resolve_restart_with_invalid_label(t *testing.T) {
+	boot, container := restarting(map[string]string{"boot.max-restarts": "many"})
+	event := started()
+
+	action := boot.resolve("restart", discard(), container, event)
+	_, ok := action.(*events.Stop)
+	assertEqual(true, ok, t)
+	restarted, _ := boot.state.Get(CONTAINER)
+	assertEqual(0, restarted.Restarts, t)
+}
@@ -1,7 +1,13 @@
 package command
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/tueftler/boot/output"
@@ -10,24 +16,226 @@ import (
 const NOTRUN = -1
 
 type Executable interface {
-	Run(stream *output.Stream) (int, error)
+	Run(ctx context.Context, stream *output.Stream) (int, error)
 	String() string
 }
 
-// Boot returns the boot command for a given Docker container
-func Boot(client *docker.Client, container *docker.Container) Executable {
-	if label, ok := container.Config.Labels["boot"]; ok {
-		command := strings.Split(label, " ")
+// Boot returns the boot command for a given Docker container. If the
+// container is labeled with "boot.retries", the command is wrapped in
+// a retry using the "boot.interval" and "boot.backoff" labels.
+func Boot(client *docker.Client, container *docker.Container) (Executable, error) {
+	boot, err := root(client, container, "boot")
+	if err != nil {
+		return nil, err
+	}
+
+	retries, err := Int(container, "boot.retries", 0)
+	if err != nil {
+		return nil, err
+	} else if retries <= 0 {
+		return boot, nil
+	}
+
+	interval, err := Duration(container, "boot.interval", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	backoff, err := Float(container, "boot.backoff", 1)
+	if err != nil {
+		return nil, err
+	} else if backoff < 1 {
+		return nil, fmt.Errorf("Label 'boot.backoff': factor %g must not be less than 1", backoff)
+	}
+
+	return &Retry{Executable: boot, Retries: retries, Interval: interval, Backoff: backoff}, nil
+}
+
+// Labeled returns the command given by a label other than "boot", e.g.
+// "boot.drain", using the same syntax. If the container is not labeled
+// with it, the command does not run.
+func Labeled(client *docker.Client, container *docker.Container, name string) (Executable, error) {
+	return root(client, container, name)
+}
+
+// Parses the named label, e.g. "boot", into an executable. If it is absent
+// or only consists of ALL or ANY, children are read from numbered labels.
+func root(client *docker.Client, container *docker.Container, name string) (Executable, error) {
+	label, ok := container.Config.Labels[name]
+	if !ok || label == "ALL" || label == "ANY" {
+		children := numbered(container, name)
+		if len(children) == 0 && !ok {
+			return &None{}, nil
+		} else if !ok {
+			label = "ALL"
+		}
+		return composite(client, container, name, label, children)
+	}
+
+	return parse(client, container, name, label)
+}
+
+// Parses a label into an executable. The label is split into words
+// like a shell would, or parsed as JSON array if it starts with "[".
+func parse(client *docker.Client, container *docker.Container, name, label string) (Executable, error) {
+	kind, rest := head(label)
+
+	switch {
+	case kind == "":
+		return nil, fmt.Errorf("Label '%s': empty command", name)
+
+	case strings.HasPrefix(kind, "["):
+		command, err := array(strings.TrimSpace(label))
+		if err != nil {
+			return nil, fmt.Errorf("Label '%s': %s", name, err.Error())
+		}
+		return execute(client, container, command), nil
+
+	case kind == "CMD" && strings.HasPrefix(rest, "["):
+		return parse(client, container, name, rest)
+
+	case kind == "CMD":
+		if rest == "" {
+			return nil, fmt.Errorf("Label '%s': CMD expects a command", name)
+		}
+		return execute(client, container, []string{"/bin/sh", "-c", rest}), nil
+
+	case kind == "ALL" || kind == "ANY":
+		children, err := array(rest)
+		if err != nil {
+			return nil, fmt.Errorf("Label '%s': %s %s", name, kind, err.Error())
+		}
+		return composite(client, container, name, kind, children)
+	}
+
+	command, err := split(label)
+	if err != nil {
+		return nil, fmt.Errorf("Label '%s': %s", name, err.Error())
+	}
+
+	switch command[0] {
+	case "NONE":
+		return &None{}, nil
+	case "HTTP":
+		return probeHttp(container, name, command[1:])
+	case "TCP":
+		return probeTcp(container, name, command[1:])
+	case "HEALTHY":
+		return probeHealthy(client, container, name, command[1:])
+	case "LOG":
+		return probeLogs(client, container, name, command[1:])
+	default:
+		return execute(client, container, command), nil
+	}
+}
+
+// Returns the values of the labels "boot.0", "boot.1", ... for a label
+// named "boot", up until the first missing number
+func numbered(container *docker.Container, name string) []string {
+	children := make([]string, 0)
+	for i := 0; ; i++ {
+		label, ok := container.Config.Labels[name+"."+strconv.Itoa(i)]
+		if !ok {
+			return children
+		}
+		children = append(children, label)
+	}
+}
+
+// Creates a composite of the given kind, ALL or ANY, running in parallel
+// if the container is labeled with "boot.parallel=true"
+func composite(client *docker.Client, container *docker.Container, name, kind string, labels []string) (Executable, error) {
+	if len(labels) == 0 {
+		return nil, fmt.Errorf("Label '%s': %s expects at least one command", name, kind)
+	}
+
+	parallel, err := Bool(container, "boot.parallel", false)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make([]Executable, len(labels))
+	for i, label := range labels {
+		if children[i], err = parse(client, container, name, label); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Composite{Children: children, Any: kind == "ANY", Parallel: parallel}, nil
+}
+
+// Parses arguments to HTTP kind, e.g. "HTTP :8080/healthz 200"
+func probeHttp(container *docker.Container, name string, args []string) (Executable, error) {
+	if len(args) < 1 || len(args) > 2 {
+		return nil, fmt.Errorf("Label '%s': HTTP expects a target and an optional status", name)
+	}
+
+	interval, err := Duration(container, "boot.interval", time.Second)
+	if err != nil {
+		return nil, err
+	}
 
-		switch command[0] {
-		case "NONE":
-			return &None{}
-		case "CMD":
-			return &Exec{Client: client, Container: container, Command: append([]string{"/bin/sh", "-c"}, command[1:]...)}
-		default:
-			return &Exec{Client: client, Container: container, Command: command}
+	status := http.StatusOK
+	if len(args) > 1 {
+		if status, err = strconv.Atoi(args[1]); err != nil {
+			return nil, fmt.Errorf("Label '%s': HTTP status %s", name, err.Error())
 		}
-	} else {
-		return &None{}
 	}
+
+	port, path, err := target(args[0])
+	if err != nil {
+		return nil, fmt.Errorf("Label '%s': HTTP target %s", name, err.Error())
+	}
+	return &Http{Container: container, Port: port, Path: path, Status: status, Interval: interval}, nil
+}
+
+// Parses arguments to TCP kind, e.g. "TCP 5432"
+func probeTcp(container *docker.Container, name string, args []string) (Executable, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("Label '%s': TCP expects a port", name)
+	}
+
+	if _, err := strconv.ParseUint(args[0], 10, 16); err != nil {
+		return nil, fmt.Errorf("Label '%s': TCP port %s", name, err.Error())
+	}
+
+	interval, err := Duration(container, "boot.interval", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Tcp{Container: container, Port: args[0], Interval: interval}, nil
+}
+
+// Parses arguments to HEALTHY kind, which does not take any
+func probeHealthy(client *docker.Client, container *docker.Container, name string, args []string) (Executable, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("Label '%s': HEALTHY does not expect arguments", name)
+	}
+
+	interval, err := Duration(container, "boot.interval", time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Healthy{Client: client, Container: container, Interval: interval}, nil
+}
+
+// Parses arguments to LOG kind, which takes its pattern from a label
+func probeLogs(client *docker.Client, container *docker.Container, name string, args []string) (Executable, error) {
+	if len(args) != 0 {
+		return nil, fmt.Errorf("Label '%s': LOG does not expect arguments, use 'boot.log-pattern'", name)
+	}
+
+	label, ok := container.Config.Labels["boot.log-pattern"]
+	if !ok {
+		return nil, fmt.Errorf("Label 'boot.log-pattern': required for LOG")
+	}
+
+	pattern, err := regexp.Compile(label)
+	if err != nil {
+		return nil, fmt.Errorf("Label 'boot.log-pattern': %s", err.Error())
+	}
+
+	return &Logs{Client: client, Container: container, Pattern: pattern}, nil
 }
@@ -1,10 +1,19 @@
 package command
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
+	"github.com/tueftler/boot/output"
 )
 
 func assertEqual(expect, actual interface{}, t *testing.T) {
@@ -13,6 +22,24 @@ func assertEqual(expect, actual interface{}, t *testing.T) {
 	}
 }
 
+type fake struct {
+	results []int
+	runs    int
+}
+
+func (f *fake) Run(ctx context.Context, stream *output.Stream) (int, error) {
+	f.runs++
+	return f.results[f.runs-1], nil
+}
+
+func (f *fake) String() string {
+	return "Fake"
+}
+
+func discard() *output.Stream {
+	return output.NewStream("", func(arg string) {})
+}
+
 func container(label string) *docker.Container {
 	return &docker.Container{
 		ID: "610036617aa165161127bc0cec60ae7831fdc1ddf1fdef1fb7f246cc83b0c315",
@@ -29,21 +56,730 @@ func Test_create(t *testing.T) {
 }
 
 func Test_command(t *testing.T) {
-	fixture := Boot(nil, container("/boot.sh"))
+	fixture, _ := Boot(nil, container("/boot.sh"))
 	assertEqual([]string{"/boot.sh"}, fixture.(*Exec).Command, t)
 }
 
 func Test_none_kind(t *testing.T) {
-	fixture := Boot(nil, container("NONE"))
+	fixture, _ := Boot(nil, container("NONE"))
 	assertEqual("None", fixture.String(), t)
 }
 
 func Test_cmd_kind(t *testing.T) {
-	fixture := Boot(nil, container("CMD /boot.sh"))
+	fixture, _ := Boot(nil, container("CMD /boot.sh"))
 	assertEqual("Exec{[/bin/sh -c /boot.sh] @ 610036617aa16}", fixture.String(), t)
 }
 
 func Test_default_kind(t *testing.T) {
-	fixture := Boot(nil, container("/boot.sh"))
+	fixture, _ := Boot(nil, container("/boot.sh"))
 	assertEqual("Exec{[/boot.sh] @ 610036617aa16}", fixture.String(), t)
 }
+
+func Test_label(t *testing.T) {
+	assertEqual("/boot.sh", Label(container("/boot.sh"), "boot", ""), t)
+}
+
+func Test_label_fallback(t *testing.T) {
+	assertEqual("drop", Label(container("/boot.sh"), "boot.on-timeout", "drop"), t)
+}
+
+func Test_duration(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.timeout"] = "1m30s"
+
+	duration, err := Duration(fixture, "boot.timeout", 0)
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(90*time.Second, duration, t)
+}
+
+func Test_duration_fallback(t *testing.T) {
+	duration, err := Duration(container("/boot.sh"), "boot.timeout", 5*time.Second)
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(5*time.Second, duration, t)
+}
+
+func Test_duration_invalid(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.timeout"] = "forever"
+
+	if _, err := Duration(fixture, "boot.timeout", 0); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_none_run(t *testing.T) {
+	fixture, _ := Boot(nil, container("NONE"))
+	result, err := fixture.Run(context.Background(), nil)
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(NOTRUN, result, t)
+}
+
+func Test_retries_kind(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.retries"] = "3"
+	fixture.Config.Labels["boot.backoff"] = "2"
+
+	boot, err := Boot(nil, fixture)
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual("Retry{Exec{[/boot.sh] @ 610036617aa16} x3 every 1s *2}", boot.String(), t)
+}
+
+func Test_retries_invalid_backoff(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.retries"] = "3"
+	fixture.Config.Labels["boot.backoff"] = "0.5"
+
+	if _, err := Boot(nil, fixture); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_retry_until_success(t *testing.T) {
+	executable := &fake{results: []int{1, 1, 0}}
+	fixture := &Retry{Executable: executable, Retries: 3, Interval: time.Millisecond, Backoff: 1}
+
+	result, err := fixture.Run(context.Background(), discard())
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(0, result, t)
+	assertEqual(3, executable.runs, t)
+}
+
+func Test_retry_budget_exhausted(t *testing.T) {
+	executable := &fake{results: []int{1, 2, 3}}
+	fixture := &Retry{Executable: executable, Retries: 2, Interval: time.Millisecond, Backoff: 2}
+
+	result, err := fixture.Run(context.Background(), discard())
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(3, result, t)
+	assertEqual(3, executable.runs, t)
+}
+
+func Test_retry_logs_attempts(t *testing.T) {
+	written := ""
+	stream := output.NewStream("> ", func(arg string) { written += arg })
+	fixture := &Retry{Executable: &fake{results: []int{1, 0}}, Retries: 1, Interval: time.Millisecond, Backoff: 1}
+	fixture.Run(context.Background(), stream)
+
+	assertEqual("> "+output.Text("warning", "Attempt 1/2 exited with 1, retrying in 1ms")+"\n", written, t)
+}
+
+func Test_retry_not_run(t *testing.T) {
+	executable := &fake{results: []int{NOTRUN}}
+	fixture := &Retry{Executable: executable, Retries: 3, Interval: time.Millisecond, Backoff: 1}
+
+	result, _ := fixture.Run(context.Background(), discard())
+	assertEqual(NOTRUN, result, t)
+	assertEqual(1, executable.runs, t)
+}
+
+func Test_http_kind(t *testing.T) {
+	fixture, _ := Boot(nil, container("HTTP :8080/healthz"))
+	assertEqual("Http{:8080/healthz == 200 @ 610036617aa16}", fixture.String(), t)
+}
+
+func Test_http_kind_with_status(t *testing.T) {
+	fixture, _ := Boot(nil, container("HTTP :8080/ 204"))
+	assertEqual("Http{:8080/ == 204 @ 610036617aa16}", fixture.String(), t)
+}
+
+func Test_http_kind_defaults(t *testing.T) {
+	fixture, _ := Boot(nil, container("HTTP /"))
+	assertEqual("Http{:80/ == 200 @ 610036617aa16}", fixture.String(), t)
+}
+
+func Test_http_kind_without_target(t *testing.T) {
+	if _, err := Boot(nil, container("HTTP")); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_http_kind_invalid_target(t *testing.T) {
+	for _, label := range []string{"HTTP 8080/healthz", "HTTP localhost:8080/", "HTTP :abc/x", "HTTP :65536/"} {
+		if _, err := Boot(nil, container(label)); err == nil {
+			t.Errorf("Expected an error for %s", label)
+		}
+	}
+}
+
+func Test_http_kind_invalid_target_error(t *testing.T) {
+	_, err := Boot(nil, container("HTTP 8080/healthz"))
+	assertEqual("Label 'boot': HTTP target '8080/healthz' must start with : or /", err.Error(), t)
+}
+
+func Test_http_run(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if requests < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	fixture := container("HTTP :" + port + "/healthz")
+	fixture.Config.Labels["boot.interval"] = "1ms"
+	fixture.NetworkSettings = &docker.NetworkSettings{IPAddress: "127.0.0.1"}
+
+	boot, _ := Boot(nil, fixture)
+	result, err := boot.Run(context.Background(), discard())
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(0, result, t)
+	assertEqual(2, requests, t)
+}
+
+func Test_http_run_timeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	fixture := container("HTTP :" + port + "/healthz")
+	fixture.Config.Labels["boot.interval"] = "1ms"
+	fixture.NetworkSettings = &docker.NetworkSettings{IPAddress: "127.0.0.1"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	boot, _ := Boot(nil, fixture)
+	if _, err := boot.Run(ctx, discard()); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline to be exceeded, have %v", err)
+	}
+}
+
+func Test_address(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.NetworkSettings = &docker.NetworkSettings{Networks: map[string]docker.ContainerNetwork{
+		"b": {IPAddress: "172.18.0.2"},
+		"a": {IPAddress: "172.17.0.2"},
+	}}
+
+	ip, err := address(fixture)
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual("172.17.0.2", ip, t)
+}
+
+func Test_address_network_label(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.network"] = "b"
+	fixture.NetworkSettings = &docker.NetworkSettings{Networks: map[string]docker.ContainerNetwork{
+		"b": {IPAddress: "172.18.0.2"},
+		"a": {IPAddress: "172.17.0.2"},
+	}}
+
+	ip, err := address(fixture)
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual("172.18.0.2", ip, t)
+}
+
+func Test_tcp_kind(t *testing.T) {
+	fixture, _ := Boot(nil, container("TCP 5432"))
+	assertEqual("Tcp{:5432 @ 610036617aa16}", fixture.String(), t)
+}
+
+func Test_tcp_kind_invalid_port(t *testing.T) {
+	if _, err := Boot(nil, container("TCP postgres")); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_tcp_run(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+	fixture := container("TCP " + port)
+	fixture.NetworkSettings = &docker.NetworkSettings{IPAddress: "127.0.0.1"}
+
+	written := ""
+	boot, _ := Boot(nil, fixture)
+	result, err := boot.Run(context.Background(), output.NewStream("> ", func(arg string) { written += arg }))
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(0, result, t)
+	assertEqual("> Connect 127.0.0.1:"+port+" -> OK\n", written, t)
+}
+
+func Test_tcp_run_timeout(t *testing.T) {
+	server, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, port, _ := net.SplitHostPort(server.Addr().String())
+	server.Close()
+
+	fixture := container("TCP " + port)
+	fixture.Config.Labels["boot.interval"] = "1ms"
+	fixture.NetworkSettings = &docker.NetworkSettings{IPAddress: "127.0.0.1"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	boot, _ := Boot(nil, fixture)
+	if _, err := boot.Run(ctx, discard()); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline to be exceeded, have %v", err)
+	}
+}
+
+func daemon(t *testing.T, handler http.HandlerFunc) (*docker.Client, func()) {
+	server := httptest.NewServer(handler)
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server.Close
+}
+
+func healthy(label string) *docker.Container {
+	fixture := container(label)
+	fixture.Config.Labels["boot.interval"] = "1ms"
+	fixture.Config.Healthcheck = &docker.HealthConfig{Test: []string{"CMD", "/health.sh"}}
+	return fixture
+}
+
+func Test_healthy_kind(t *testing.T) {
+	fixture, _ := Boot(nil, container("HEALTHY"))
+	assertEqual("Healthy{@ 610036617aa16}", fixture.String(), t)
+}
+
+func Test_healthy_kind_with_arguments(t *testing.T) {
+	if _, err := Boot(nil, container("HEALTHY /health.sh")); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_healthy_run(t *testing.T) {
+	statuses := []string{"starting", "starting", "healthy"}
+	client, stop := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"State": {"Health": {"Status": "%s"}}}`, statuses[0])
+		statuses = statuses[1:]
+	})
+	defer stop()
+
+	written := ""
+	boot, _ := Boot(client, healthy("HEALTHY"))
+	result, err := boot.Run(context.Background(), output.NewStream("> ", func(arg string) { written += arg }))
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(0, result, t)
+	assertEqual("> Health -> starting\n> Health -> healthy\n", written, t)
+}
+
+func Test_healthy_run_unhealthy(t *testing.T) {
+	client, stop := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"State": {"Health": {"Status": "unhealthy", "Log": [{"Output": "Connection refused\n"}]}}}`)
+	})
+	defer stop()
+
+	written := ""
+	boot, _ := Boot(client, healthy("HEALTHY"))
+	result, err := boot.Run(context.Background(), output.NewStream("> ", func(arg string) { written += arg }))
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(1, result, t)
+	assertEqual("> Health -> unhealthy\n> Connection refused\n", written, t)
+}
+
+func Test_healthy_run_without_healthcheck(t *testing.T) {
+	boot, _ := Boot(nil, container("HEALTHY"))
+	if _, err := boot.Run(context.Background(), discard()); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func logs(pattern string) *docker.Container {
+	fixture := container("LOG")
+	fixture.Config.Labels["boot.log-pattern"] = pattern
+	fixture.Config.Tty = true
+	return fixture
+}
+
+func Test_log_kind(t *testing.T) {
+	fixture, _ := Boot(nil, logs("Server started"))
+	assertEqual("Logs{/Server started/ @ 610036617aa16}", fixture.String(), t)
+}
+
+func Test_log_kind_without_pattern(t *testing.T) {
+	if _, err := Boot(nil, container("LOG")); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_log_kind_invalid_pattern(t *testing.T) {
+	if _, err := Boot(nil, logs("Server (started")); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_log_run(t *testing.T) {
+	client, stop := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Starting\nServer started on :8080\n")
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	defer stop()
+
+	written := ""
+	boot, _ := Boot(client, logs("Server started"))
+	result, err := boot.Run(context.Background(), output.NewStream("> ", func(arg string) { written += arg }))
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(0, result, t)
+	assertEqual("> Starting\n> Server started on :8080\n", written, t)
+}
+
+func Test_log_run_ended(t *testing.T) {
+	client, stop := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "Starting\nFatal error\n")
+	})
+	defer stop()
+
+	boot, _ := Boot(client, logs("Server started"))
+	result, err := boot.Run(context.Background(), discard())
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(1, result, t)
+}
+
+type hang struct{}
+
+func (h *hang) Run(ctx context.Context, stream *output.Stream) (int, error) {
+	<-ctx.Done()
+	return -1, ctx.Err()
+}
+
+func (h *hang) String() string {
+	return "Hang"
+}
+
+func Test_all_kind_numbered(t *testing.T) {
+	fixture := container("ALL")
+	fixture.Config.Labels["boot.0"] = "TCP 8080"
+	fixture.Config.Labels["boot.1"] = "/ready.sh"
+
+	boot, _ := Boot(nil, fixture)
+	assertEqual("All{Tcp{:8080 @ 610036617aa16}, Exec{[/ready.sh] @ 610036617aa16}}", boot.String(), t)
+}
+
+func Test_numbered_without_boot_label(t *testing.T) {
+	fixture := container("")
+	delete(fixture.Config.Labels, "boot")
+	fixture.Config.Labels["boot.0"] = "TCP 8080"
+
+	boot, _ := Boot(nil, fixture)
+	assertEqual("All{Tcp{:8080 @ 610036617aa16}}", boot.String(), t)
+}
+
+func Test_any_kind_json(t *testing.T) {
+	fixture := container(`ANY ["TCP 8080", "HTTP :8080/"]`)
+	fixture.Config.Labels["boot.parallel"] = "true"
+
+	boot, _ := Boot(nil, fixture)
+	assertEqual("Any(parallel){Tcp{:8080 @ 610036617aa16}, Http{:8080/ == 200 @ 610036617aa16}}", boot.String(), t)
+}
+
+func Test_all_kind_without_children(t *testing.T) {
+	if _, err := Boot(nil, container("ALL")); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_all_kind_invalid_json(t *testing.T) {
+	if _, err := Boot(nil, container("ALL [TCP 8080]")); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_all_sequential(t *testing.T) {
+	first, second := &fake{results: []int{0}}, &fake{results: []int{0}}
+	fixture := &Composite{Children: []Executable{first, second}}
+
+	result, err := fixture.Run(context.Background(), discard())
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(0, result, t)
+	assertEqual(1, second.runs, t)
+}
+
+func Test_all_sequential_stops_at_failure(t *testing.T) {
+	first, second := &fake{results: []int{2}}, &fake{results: []int{0}}
+	fixture := &Composite{Children: []Executable{first, second}}
+
+	result, _ := fixture.Run(context.Background(), discard())
+	assertEqual(2, result, t)
+	assertEqual(0, second.runs, t)
+}
+
+func Test_any_sequential_stops_at_success(t *testing.T) {
+	first, second, third := &fake{results: []int{1}}, &fake{results: []int{0}}, &fake{results: []int{0}}
+	fixture := &Composite{Children: []Executable{first, second, third}, Any: true}
+
+	result, _ := fixture.Run(context.Background(), discard())
+	assertEqual(0, result, t)
+	assertEqual(0, third.runs, t)
+}
+
+func Test_any_sequential_all_failing(t *testing.T) {
+	fixture := &Composite{Children: []Executable{&fake{results: []int{1}}, &fake{results: []int{2}}}, Any: true}
+
+	result, _ := fixture.Run(context.Background(), discard())
+	assertEqual(2, result, t)
+}
+
+func Test_all_not_run(t *testing.T) {
+	fixture := &Composite{Children: []Executable{&None{}, &None{}}}
+
+	result, _ := fixture.Run(context.Background(), discard())
+	assertEqual(NOTRUN, result, t)
+}
+
+func Test_all_parallel_cancels_on_failure(t *testing.T) {
+	fixture := &Composite{Children: []Executable{&hang{}, &fake{results: []int{1}}}, Parallel: true}
+
+	result, err := fixture.Run(context.Background(), discard())
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(1, result, t)
+}
+
+func Test_any_parallel_cancels_on_success(t *testing.T) {
+	fixture := &Composite{Children: []Executable{&hang{}, &fake{results: []int{0}}}, Any: true, Parallel: true}
+
+	result, err := fixture.Run(context.Background(), discard())
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual(0, result, t)
+}
+
+func Test_all_parallel_timeout(t *testing.T) {
+	fixture := &Composite{Children: []Executable{&hang{}, &fake{results: []int{0}}}, Parallel: true}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	if _, err := fixture.Run(ctx, discard()); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline to be exceeded, have %v", err)
+	}
+}
+
+func Test_split(t *testing.T) {
+	words, err := split(`/boot.sh  --wait "--name=my app" 'it''s' a\ b "\"q\" \n"`)
+	if err != nil {
+		t.Error(err)
+	}
+	assertEqual([]string{"/boot.sh", "--wait", "--name=my app", "its", "a b", `"q" \n`}, words, t)
+}
+
+func Test_split_empty_quotes(t *testing.T) {
+	words, _ := split(`/boot.sh ""`)
+	assertEqual([]string{"/boot.sh", ""}, words, t)
+}
+
+func Test_split_unterminated_quote(t *testing.T) {
+	if _, err := split(`/boot.sh "--name=my app`); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_split_trailing_backslash(t *testing.T) {
+	if _, err := split(`/boot.sh \`); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_quoted_command(t *testing.T) {
+	fixture, _ := Boot(nil, container(`/boot.sh "--name=my app"`))
+	assertEqual([]string{"/boot.sh", "--name=my app"}, fixture.(*Exec).Command, t)
+}
+
+func Test_json_command(t *testing.T) {
+	fixture, _ := Boot(nil, container(`["/boot.sh", "--wait"]`))
+	assertEqual([]string{"/boot.sh", "--wait"}, fixture.(*Exec).Command, t)
+}
+
+func Test_cmd_kind_json(t *testing.T) {
+	fixture, _ := Boot(nil, container(`CMD ["/boot.sh", "--wait"]`))
+	assertEqual([]string{"/boot.sh", "--wait"}, fixture.(*Exec).Command, t)
+}
+
+func Test_cmd_kind_passes_rest_to_shell(t *testing.T) {
+	fixture, _ := Boot(nil, container(`CMD  /boot.sh --name="my app" && echo OK`))
+	assertEqual([]string{"/bin/sh", "-c", `/boot.sh --name="my app" && echo OK`}, fixture.(*Exec).Command, t)
+}
+
+func Test_invalid_json_command(t *testing.T) {
+	if _, err := Boot(nil, container(`["/boot.sh", --wait]`)); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_invalid_quoted_command(t *testing.T) {
+	if _, err := Boot(nil, container(`/boot.sh "--name=my app`)); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_empty_command(t *testing.T) {
+	if _, err := Boot(nil, container("  ")); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func options() *docker.Container {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.user"] = "www-data"
+	fixture.Config.Labels["boot.workdir"] = "/srv"
+	fixture.Config.Labels["boot.env.PORT"] = "8080"
+	fixture.Config.Labels["boot.env.MODE"] = "check"
+	return fixture
+}
+
+func Test_exec_options(t *testing.T) {
+	fixture, _ := Boot(nil, options())
+	exec := fixture.(*Exec)
+
+	assertEqual("www-data", exec.User, t)
+	assertEqual("/srv", exec.WorkingDir, t)
+	assertEqual([]string{"MODE=check", "PORT=8080"}, exec.Env, t)
+}
+
+func Test_exec_without_options(t *testing.T) {
+	fixture, _ := Boot(nil, container("/boot.sh"))
+	exec := fixture.(*Exec)
+
+	assertEqual("", exec.User, t)
+	assertEqual("", exec.WorkingDir, t)
+	assertEqual([]string{}, exec.Env, t)
+}
+
+func Test_cmd_kind_exec_options(t *testing.T) {
+	fixture := options()
+	fixture.Config.Labels["boot"] = "CMD /boot.sh"
+
+	boot, _ := Boot(nil, fixture)
+	assertEqual("www-data", boot.(*Exec).User, t)
+}
+
+func Test_exec_run_passes_options(t *testing.T) {
+	var created docker.CreateExecOptions
+	client, stop := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/exec") {
+			json.NewDecoder(r.Body).Decode(&created)
+			w.WriteHeader(http.StatusNotFound)
+		} else {
+			fmt.Fprint(w, `{"ApiVersion": "1.41"}`)
+		}
+	})
+	defer stop()
+
+	boot, _ := Boot(client, options())
+	if _, err := boot.Run(context.Background(), discard()); err == nil {
+		t.Error("Expected an error")
+	}
+	assertEqual("www-data", created.User, t)
+	assertEqual("/srv", created.WorkingDir, t)
+	assertEqual([]string{"MODE=check", "PORT=8080"}, created.Env, t)
+	assertEqual([]string{"/boot.sh"}, created.Cmd, t)
+}
+
+func Test_exec_run_timeout(t *testing.T) {
+	release := make(chan bool)
+	defer close(release)
+	client, stop := daemon(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/exec"):
+			fmt.Fprint(w, `{"Id": "4711"}`)
+		case strings.HasSuffix(r.URL.Path, "/start"):
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			defer conn.Close()
+			fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Type: application/vnd.docker.raw-stream\r\n\r\n")
+			<-release
+		case strings.HasSuffix(r.URL.Path, "/json"):
+			fmt.Fprint(w, `{"ID": "4711", "Running": true}`)
+		default:
+			fmt.Fprint(w, `{"ApiVersion": "1.41"}`)
+		}
+	})
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	warned := false
+	stream := output.NewStream("", func(arg string) { warned = warned || strings.Contains(arg, "still running") })
+	boot, _ := Boot(client, container("/boot.sh"))
+	if _, err := boot.Run(ctx, stream); err != context.DeadlineExceeded {
+		t.Errorf("Expected deadline to be exceeded, have %v", err)
+	}
+	assertEqual(true, warned, t)
+}
+
+func Test_list(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.after"] = "db, cache,,"
+
+	assertEqual([]string{"db", "cache"}, List(fixture, "boot.after"), t)
+}
+
+func Test_list_absent(t *testing.T) {
+	assertEqual([]string{}, List(container("/boot.sh"), "boot.after"), t)
+}
+
+func Test_labeled(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.drain"] = "/drain.sh"
+
+	drain, _ := Labeled(nil, fixture, "boot.drain")
+	assertEqual("Exec{[/drain.sh] @ 610036617aa16}", drain.String(), t)
+}
+
+func Test_labeled_numbered(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.drain.0"] = "/drain.sh"
+
+	drain, _ := Labeled(nil, fixture, "boot.drain")
+	assertEqual("All{Exec{[/drain.sh] @ 610036617aa16}}", drain.String(), t)
+}
+
+func Test_labeled_absent(t *testing.T) {
+	drain, _ := Labeled(nil, container("/boot.sh"), "boot.drain")
+	assertEqual("None", drain.String(), t)
+}
+
+func Test_labeled_error(t *testing.T) {
+	fixture := container("/boot.sh")
+	fixture.Config.Labels["boot.drain"] = "TCP"
+
+	_, err := Labeled(nil, fixture, "boot.drain")
+	assertEqual("Label 'boot.drain': TCP expects a port", err.Error(), t)
+}
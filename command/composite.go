@@ -0,0 +1,104 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tueftler/boot/output"
+)
+
+type Composite struct {
+	Children []Executable
+	Any      bool
+	Parallel bool
+}
+
+type outcome struct {
+	result int
+	err    error
+}
+
+// Succeeded returns whether this outcome counts as success. Children
+// which did not run are regarded as successful.
+func (o outcome) succeeded() bool {
+	return o.err == nil && (o.result == 0 || o.result == NOTRUN)
+}
+
+// Run runs all children, either one after another or in parallel. With
+// all semantics, stops at the first failing child and returns its result;
+// with any semantics, stops at the first succeeding child. Children still
+// running at that point are cancelled.
+func (c *Composite) Run(ctx context.Context, stream *output.Stream) (int, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var next func() outcome
+	if c.Parallel {
+		next = c.parallel(ctx, stream)
+	} else {
+		next = c.sequential(ctx, stream)
+	}
+
+	last := outcome{NOTRUN, nil}
+	ran := false
+	for range c.Children {
+		current := next()
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		} else if current.succeeded() == c.Any {
+			return current.result, current.err
+		}
+
+		ran = ran || current.result != NOTRUN
+		last = current
+	}
+
+	if ran && last.succeeded() {
+		return 0, nil
+	}
+	return last.result, last.err
+}
+
+// Returns a function running the next child each time it is called
+func (c *Composite) sequential(ctx context.Context, stream *output.Stream) func() outcome {
+	i := 0
+	return func() outcome {
+		result, err := c.Children[i].Run(ctx, stream)
+		i++
+		return outcome{result, err}
+	}
+}
+
+// Starts all children in parallel, each writing to its own numbered stream,
+// and returns a function waiting for the next one to finish
+func (c *Composite) parallel(ctx context.Context, stream *output.Stream) func() outcome {
+	outcomes := make(chan outcome, len(c.Children))
+	for i, child := range c.Children {
+		go func(child Executable, stream *output.Stream) {
+			result, err := child.Run(ctx, stream)
+			outcomes <- outcome{result, err}
+		}(child, stream.Prefixed(fmt.Sprintf("%s[%d] ", stream.Prefix, i)))
+	}
+
+	return func() outcome {
+		return <-outcomes
+	}
+}
+
+// String returns a string representation of this command
+func (c *Composite) String() string {
+	children := make([]string, len(c.Children))
+	for i, child := range c.Children {
+		children[i] = child.String()
+	}
+
+	name := "All"
+	if c.Any {
+		name = "Any"
+	}
+	if c.Parallel {
+		name += "(parallel)"
+	}
+	return name + "{" + strings.Join(children, ", ") + "}"
+}
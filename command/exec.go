@@ -1,21 +1,52 @@
 package command
 
 import (
+	"context"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/tueftler/boot/output"
 )
 
 type Exec struct {
-	Client    *docker.Client
-	Container *docker.Container
-	Command   []string
+	Client     *docker.Client
+	Container  *docker.Container
+	Command    []string
+	User       string
+	WorkingDir string
+	Env        []string
+}
+
+// Execute creates an exec for the given command line inside the container,
+// using the "boot.user", "boot.workdir" and "boot.env.*" labels.
+func execute(client *docker.Client, container *docker.Container, command []string) *Exec {
+	env := make([]string, 0)
+	for name, value := range container.Config.Labels {
+		if strings.HasPrefix(name, "boot.env.") && len(name) > len("boot.env.") {
+			env = append(env, name[len("boot.env."):]+"="+value)
+		}
+	}
+	sort.Strings(env)
+
+	return &Exec{
+		Client:     client,
+		Container:  container,
+		Command:    command,
+		User:       container.Config.Labels["boot.user"],
+		WorkingDir: container.Config.Labels["boot.workdir"],
+		Env:        env,
+	}
 }
 
 // Run executes the given command line inside the container, streaming
 // it STDOUT and STDERR to the given stream and returning its exitcode.
-func (e *Exec) Run(stream *output.Stream) (int, error) {
+// If the context is done before the command finishes, we detach from
+// it and return the context's error. The Docker API offers no way to
+// stop an exec'd process, so it keeps running inside the container;
+// a warning is written to the stream if it does.
+func (e *Exec) Run(ctx context.Context, stream *output.Stream) (int, error) {
 	exec, err := e.Client.CreateExec(docker.CreateExecOptions{
 		AttachStdin:  false,
 		AttachStdout: true,
@@ -23,20 +54,44 @@ func (e *Exec) Run(stream *output.Stream) (int, error) {
 		Tty:          false,
 		Cmd:          e.Command,
 		Container:    e.Container.ID,
+		User:         e.User,
+		WorkingDir:   e.WorkingDir,
+		Env:          e.Env,
+		Context:      ctx,
 	})
 	if err != nil {
 		return -1, err
 	}
 
-	err = e.Client.StartExec(exec.ID, docker.StartExecOptions{
+	waiter, err := e.Client.StartExecNonBlocking(exec.ID, docker.StartExecOptions{
 		OutputStream: stream,
 		ErrorStream:  stream,
 		RawTerminal:  false,
+		Context:      ctx,
 	})
 	if err != nil {
 		return -1, err
 	}
 
+	finished := make(chan error, 1)
+	go func() {
+		finished <- waiter.Wait()
+	}()
+
+	select {
+	case err = <-finished:
+		if err != nil {
+			return -1, err
+		}
+
+	case <-ctx.Done():
+		waiter.Close()
+		if inspect, err := e.Client.InspectExec(exec.ID); err == nil && inspect.Running {
+			stream.Warning("Detached from %s, still running: %s", e.Command, ctx.Err().Error())
+		}
+		return -1, ctx.Err()
+	}
+
 	inspect, err := e.Client.InspectExec(exec.ID)
 	if err != nil {
 		return -1, err
@@ -0,0 +1,60 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tueftler/boot/output"
+)
+
+type Healthy struct {
+	Client    *docker.Client
+	Container *docker.Container
+	Interval  time.Duration
+}
+
+// Run waits for the container's HEALTHCHECK to report it is healthy,
+// returning 0. If it reports the container is unhealthy, the output of
+// the last check is written to the stream and 1 is returned.
+func (h *Healthy) Run(ctx context.Context, stream *output.Stream) (int, error) {
+	if h.Container.Config.Healthcheck == nil || len(h.Container.Config.Healthcheck.Test) == 0 || h.Container.Config.Healthcheck.Test[0] == "NONE" {
+		return -1, fmt.Errorf("Container %s has no healthcheck", h.Container.ID[0:13])
+	}
+
+	status := ""
+	return poll(ctx, h.Interval, func() (int, bool) {
+		container, err := h.Client.InspectContainerWithContext(h.Container.ID, ctx)
+		if err != nil {
+			stream.Println("Inspect ->", err.Error())
+			return -1, false
+		}
+
+		health := container.State.Health
+		if health.Status != status {
+			stream.Println("Health ->", health.Status)
+			status = health.Status
+		}
+
+		switch health.Status {
+		case "healthy":
+			return 0, true
+
+		case "unhealthy":
+			if len(health.Log) > 0 {
+				stream.Println(strings.TrimSpace(health.Log[len(health.Log)-1].Output))
+			}
+			return 1, true
+
+		default:
+			return -1, false
+		}
+	})
+}
+
+// String returns a string representation of this command
+func (h *Healthy) String() string {
+	return fmt.Sprintf("Healthy{@ %s}", h.Container.ID[0:13])
+}
@@ -0,0 +1,76 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tueftler/boot/output"
+)
+
+type Http struct {
+	Container *docker.Container
+	Port      string
+	Path      string
+	Status    int
+	Interval  time.Duration
+}
+
+// Run polls the given path on the container's port until it returns the
+// expected status code, writing each attempt's outcome to the stream.
+func (h *Http) Run(ctx context.Context, stream *output.Stream) (int, error) {
+	ip, err := address(h.Container)
+	if err != nil {
+		return -1, err
+	}
+
+	url := "http://" + net.JoinHostPort(ip, h.Port) + h.Path
+	client := &http.Client{Timeout: ATTEMPT}
+	return poll(ctx, h.Interval, func() (int, bool) {
+		request, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			stream.Println("GET", url, "->", err.Error())
+			return -1, false
+		}
+
+		response, err := client.Do(request.WithContext(ctx))
+		if err != nil {
+			stream.Println("GET", url, "->", err.Error())
+			return -1, false
+		}
+		response.Body.Close()
+
+		stream.Println("GET", url, "->", response.Status)
+		return 0, response.StatusCode == h.Status
+	})
+}
+
+// String returns a string representation of this command
+func (h *Http) String() string {
+	return fmt.Sprintf("Http{:%s%s == %d @ %s}", h.Port, h.Path, h.Status, h.Container.ID[0:13])
+}
+
+// Parses a target such as ":8080/healthz" into port and path. The port
+// defaults to 80, the path to "/".
+func target(input string) (string, string, error) {
+	if !strings.HasPrefix(input, ":") && !strings.HasPrefix(input, "/") {
+		return "", "", fmt.Errorf("'%s' must start with : or /", input)
+	}
+
+	port, path := "80", "/"
+	if pos := strings.Index(input, "/"); pos != -1 {
+		input, path = input[0:pos], input[pos:]
+	}
+	if strings.HasPrefix(input, ":") {
+		port = input[1:]
+		if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+			return "", "", fmt.Errorf("port %s", err.Error())
+		}
+	}
+	return port, path, nil
+}
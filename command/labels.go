@@ -0,0 +1,91 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Label returns the value of a given label on the container, or the
+// given fallback if the container does not carry this label.
+func Label(container *docker.Container, name, fallback string) string {
+	if value, ok := container.Config.Labels[name]; ok {
+		return value
+	}
+	return fallback
+}
+
+// Duration parses a given label on the container as a duration, e.g.
+// "30s" or "1m30s", returning the given fallback if it is not present.
+func Duration(container *docker.Container, name string, fallback time.Duration) (time.Duration, error) {
+	value, ok := container.Config.Labels[name]
+	if !ok {
+		return fallback, nil
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Label '%s': %s", name, err.Error())
+	}
+	return duration, nil
+}
+
+// Int parses a given label on the container as an integer, returning the
+// given fallback if it is not present.
+func Int(container *docker.Container, name string, fallback int) (int, error) {
+	value, ok := container.Config.Labels[name]
+	if !ok {
+		return fallback, nil
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("Label '%s': %s", name, err.Error())
+	}
+	return number, nil
+}
+
+// Float parses a given label on the container as a floating point number,
+// returning the given fallback if it is not present.
+func Float(container *docker.Container, name string, fallback float64) (float64, error) {
+	value, ok := container.Config.Labels[name]
+	if !ok {
+		return fallback, nil
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("Label '%s': %s", name, err.Error())
+	}
+	return number, nil
+}
+
+// Bool parses a given label on the container as a boolean, e.g. "true"
+// or "false", returning the given fallback if it is not present.
+func Bool(container *docker.Container, name string, fallback bool) (bool, error) {
+	value, ok := container.Config.Labels[name]
+	if !ok {
+		return fallback, nil
+	}
+
+	flag, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("Label '%s': %s", name, err.Error())
+	}
+	return flag, nil
+}
+
+// List parses a given label on the container as a comma-separated list,
+// returning an empty list if it is not present.
+func List(container *docker.Container, name string) []string {
+	list := make([]string, 0)
+	for _, value := range strings.Split(container.Config.Labels[name], ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			list = append(list, value)
+		}
+	}
+	return list
+}
@@ -0,0 +1,86 @@
+package command
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"regexp"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tueftler/boot/output"
+)
+
+type Logs struct {
+	Client    *docker.Client
+	Container *docker.Container
+	Pattern   *regexp.Regexp
+}
+
+// Matches lines written to it against a pattern, echoing them to a stream
+type matcher struct {
+	pattern *regexp.Regexp
+	stream  *output.Stream
+	matched func()
+	line    []byte
+}
+
+// Write buffers the given bytes until a line is complete, then echoes it
+// and calls the matched function if it matches the pattern.
+func (m *matcher) Write(p []byte) (int, error) {
+	m.line = append(m.line, p...)
+	for {
+		pos := bytes.IndexByte(m.line, '\n')
+		if pos == -1 {
+			return len(p), nil
+		}
+
+		line := m.line[0 : pos+1]
+		m.line = m.line[pos+1:]
+		m.stream.Write(line)
+		if m.pattern.Match(line) {
+			m.matched()
+		}
+	}
+}
+
+// Run follows the container's logs since it started until a line matches
+// the pattern, returning 0. If the logs end before, e.g. because the
+// container exited, returns 1.
+func (l *Logs) Run(ctx context.Context, stream *output.Stream) (int, error) {
+	follow, stop := context.WithCancel(ctx)
+	defer stop()
+
+	matched := false
+	writer := &matcher{pattern: l.Pattern, stream: stream, matched: func() {
+		matched = true
+		stop()
+	}}
+
+	err := l.Client.Logs(docker.LogsOptions{
+		Context:      follow,
+		Container:    l.Container.ID,
+		OutputStream: writer,
+		ErrorStream:  writer,
+		Since:        l.Container.State.StartedAt.Unix(),
+		Follow:       true,
+		Stdout:       true,
+		Stderr:       true,
+		RawTerminal:  l.Container.Config.Tty,
+	})
+
+	if matched {
+		return 0, nil
+	} else if ctx.Err() != nil {
+		return -1, ctx.Err()
+	} else if err != nil {
+		return -1, err
+	}
+
+	stream.Println("Logs ended without matching", l.Pattern)
+	return 1, nil
+}
+
+// String returns a string representation of this command
+func (l *Logs) String() string {
+	return fmt.Sprintf("Logs{/%s/ @ %s}", l.Pattern, l.Container.ID[0:13])
+}
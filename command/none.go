@@ -1,6 +1,8 @@
 package command
 
 import (
+	"context"
+
 	"github.com/tueftler/boot/output"
 )
 
@@ -8,7 +10,7 @@ type None struct {
 }
 
 // Run does nothing, returns -1 as exit code
-func (n *None) Run(stream *output.Stream) (int, error) {
+func (n *None) Run(ctx context.Context, stream *output.Stream) (int, error) {
 	return NOTRUN, nil
 }
 
@@ -0,0 +1,65 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Maximum duration a single probe attempt may take
+const ATTEMPT = 5 * time.Second
+
+// Address returns the IP address Boot can reach the container on. If the
+// container is labeled with "boot.network", that network is used, else
+// the default bridge or the first network found in alphabetical order.
+func address(container *docker.Container) (string, error) {
+	if container.NetworkSettings == nil {
+		return "", fmt.Errorf("Container %s has no network settings", container.ID[0:13])
+	}
+
+	if name, ok := container.Config.Labels["boot.network"]; ok {
+		if network, ok := container.NetworkSettings.Networks[name]; ok && network.IPAddress != "" {
+			return network.IPAddress, nil
+		}
+		return "", fmt.Errorf("Container %s has no address on network '%s'", container.ID[0:13], name)
+	}
+
+	if container.NetworkSettings.IPAddress != "" {
+		return container.NetworkSettings.IPAddress, nil
+	}
+
+	names := make([]string, 0, len(container.NetworkSettings.Networks))
+	for name := range container.NetworkSettings.Networks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if ip := container.NetworkSettings.Networks[name].IPAddress; ip != "" {
+			return ip, nil
+		}
+	}
+
+	return "", fmt.Errorf("Container %s has no IP address", container.ID[0:13])
+}
+
+// Poll runs the given probe until it reports it is done, waiting for the
+// given interval in between. Returns the probe's result, or -1 and the
+// context's error if the context is done first.
+func poll(ctx context.Context, interval time.Duration, probe func() (int, bool)) (int, error) {
+	for {
+		if result, done := probe(); done {
+			return result, nil
+		}
+
+		select {
+		case <-time.After(interval):
+			continue
+
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+}
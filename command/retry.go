@@ -0,0 +1,63 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tueftler/boot/output"
+)
+
+type Retry struct {
+	Executable Executable
+	Retries    int
+	Interval   time.Duration
+	Backoff    float64
+	Attempts   int
+}
+
+// Attempts returns how often the given executable was run. Only retries
+// run more than once.
+func Attempts(executable Executable) int {
+	if retry, ok := executable.(*Retry); ok {
+		return retry.Attempts
+	}
+	return 1
+}
+
+// Run runs the executable, re-running it as long as it fails and there
+// are retries left. The interval between attempts is multiplied by the
+// backoff factor after each attempt.
+func (r *Retry) Run(ctx context.Context, stream *output.Stream) (int, error) {
+	interval := r.Interval
+	for attempt := 1; ; attempt++ {
+		r.Attempts = attempt
+		result, err := r.Executable.Run(ctx, stream)
+		if ctx.Err() != nil {
+			return -1, ctx.Err()
+		} else if err == nil && (result == 0 || result == NOTRUN) {
+			return result, nil
+		} else if attempt > r.Retries {
+			return result, err
+		}
+
+		if err != nil {
+			stream.Warning("Attempt %d/%d failed with %s, retrying in %s", attempt, r.Retries+1, err.Error(), interval)
+		} else {
+			stream.Warning("Attempt %d/%d exited with %d, retrying in %s", attempt, r.Retries+1, result, interval)
+		}
+
+		select {
+		case <-time.After(interval):
+			interval = time.Duration(float64(interval) * r.Backoff)
+
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		}
+	}
+}
+
+// String returns a string representation of this command
+func (r *Retry) String() string {
+	return fmt.Sprintf("Retry{%s x%d every %s *%g}", r.Executable, r.Retries, r.Interval, r.Backoff)
+}
@@ -0,0 +1,88 @@
+package command
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Split splits the input into words the way a shell would: words are
+// separated by whitespace, single quotes preserve everything literally,
+// inside double quotes backslash escapes double quotes and backslashes,
+// and outside quotes it escapes any character.
+func split(input string) ([]string, error) {
+	words := make([]string, 0)
+	word := make([]rune, 0)
+	inWord := false
+	quote := rune(0)
+	escaped := false
+
+	for _, c := range input {
+		switch {
+		case escaped:
+			if quote == '"' && c != '"' && c != '\\' {
+				word = append(word, '\\')
+			}
+			word = append(word, c)
+			escaped = false
+
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+
+		case quote != 0 && c == quote:
+			quote = 0
+
+		case quote != 0:
+			word = append(word, c)
+
+		case c == '\'' || c == '"':
+			quote = c
+			inWord = true
+
+		case unicode.IsSpace(c):
+			if inWord {
+				words = append(words, string(word))
+				word = word[:0]
+				inWord = false
+			}
+
+		default:
+			word = append(word, c)
+			inWord = true
+		}
+	}
+
+	if escaped {
+		return nil, fmt.Errorf("Trailing backslash in %s", input)
+	} else if quote != 0 {
+		return nil, fmt.Errorf("Unterminated %c quote in %s", quote, input)
+	}
+
+	if inWord {
+		words = append(words, string(word))
+	}
+	return words, nil
+}
+
+// Array parses a JSON array of strings, e.g. `["/boot.sh", "--wait"]`,
+// mirroring the exec form of Dockerfile instructions
+func array(input string) ([]string, error) {
+	words := make([]string, 0)
+	if err := json.Unmarshal([]byte(input), &words); err != nil {
+		return nil, fmt.Errorf("Invalid JSON array %s: %s", input, err.Error())
+	} else if len(words) == 0 {
+		return nil, fmt.Errorf("Empty JSON array %s", input)
+	}
+	return words, nil
+}
+
+// Head returns the first word of the input and the trimmed remainder
+func head(input string) (string, string) {
+	input = strings.TrimSpace(input)
+	if pos := strings.IndexFunc(input, unicode.IsSpace); pos != -1 {
+		return input[0:pos], strings.TrimSpace(input[pos:])
+	}
+	return input, ""
+}
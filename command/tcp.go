@@ -0,0 +1,45 @@
+package command
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tueftler/boot/output"
+)
+
+type Tcp struct {
+	Container *docker.Container
+	Port      string
+	Interval  time.Duration
+}
+
+// Run tries to connect to the container's port until a connection can
+// be established, writing each attempt's outcome to the stream.
+func (t *Tcp) Run(ctx context.Context, stream *output.Stream) (int, error) {
+	ip, err := address(t.Container)
+	if err != nil {
+		return -1, err
+	}
+
+	target := net.JoinHostPort(ip, t.Port)
+	dialer := &net.Dialer{Timeout: ATTEMPT}
+	return poll(ctx, t.Interval, func() (int, bool) {
+		conn, err := dialer.DialContext(ctx, "tcp", target)
+		if err != nil {
+			stream.Println("Connect", target, "->", err.Error())
+			return -1, false
+		}
+		conn.Close()
+
+		stream.Println("Connect", target, "-> OK")
+		return 0, true
+	})
+}
+
+// String returns a string representation of this command
+func (t *Tcp) String() string {
+	return fmt.Sprintf("Tcp{:%s @ %s}", t.Port, t.Container.ID[0:13])
+}
@@ -0,0 +1,39 @@
+package events
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tueftler/boot/output"
+)
+
+type After struct {
+	Event   *docker.APIEvents
+	Log     *output.Stream
+	Depends []string
+	Timeout time.Duration
+	Then    func(err error) Action
+}
+
+// Do waits for the containers this event's container depends on to be
+// ready, then performs the action returned by Then. If they don't become
+// ready within the timeout, the container dies or is destroyed meanwhile,
+// or waiting would create a dependency cycle, Then is passed the error.
+func (a *After) Do(events *Events) {
+	ctx := context.Background()
+	if a.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Timeout)
+		defer cancel()
+	}
+
+	a.Log.Info("Waiting for %s", strings.Join(a.Depends, ", "))
+	err := events.Ready.Wait(ctx, a.Event, a.Depends)
+	if err != nil {
+		a.Log.Error("Dependency error %s", err.Error())
+	}
+
+	a.Then(err).Do(events)
+}
@@ -2,8 +2,11 @@ package events
 
 import (
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/tueftler/boot/output"
@@ -18,27 +21,42 @@ type Handler func(stream *output.Stream, client *docker.Client, event *docker.AP
 type Events struct {
 	Client    *docker.Client
 	Log       *output.Stream
-	Listeners []chan *docker.APIEvents
+	Listeners *Listeners
 	Handlers  map[string]Handler
+	Ready     *Readiness
+	History   *History
+	Sequence  *Sequence
+	Backoff   time.Duration
+	lock      sync.Mutex
+	listed    map[string]int64
 }
 
+// Maximum duration to wait between reconnects
+const MAXBACKOFF = 30 * time.Second
+
 // Distribute returns an events instance which is able to distribute
 // received Docker API events to listeners, optionally intercepting them.
 func Distribute(client *docker.Client, stream *output.Stream) *Events {
 	return &Events{
 		Client:    client,
 		Log:       stream,
-		Listeners: make([]chan *docker.APIEvents, 0),
+		Listeners: Register(100, DROP, stream),
 		Handlers:  make(map[string]Handler),
+		Ready:     Track(),
+		History:   Remember(1000),
+		Sequence:  Serialize(),
+		Backoff:   time.Second,
+		listed:    make(map[string]int64),
 	}
 }
 
-// Emit distributes an event to all listeners and logs it
+// Emit distributes an event to all listeners and logs it, keeping track
+// of which containers are ready
 func (e *Events) Emit(event *docker.APIEvents) {
-	for _, listener := range e.Listeners {
-		listener <- event
-	}
-	e.Log.Printf("To %d -> %s %s %+v\n", len(e.Listeners), event.Action, event.Actor.ID[0:13], event.Actor.Attributes)
+	e.Ready.Update(event)
+	e.History.Add(event)
+	listeners := e.Listeners.Send(event)
+	e.Log.Printf("To %d -> %s %s %+v\n", listeners, event.Action, event.Actor.ID[0:13], event.Actor.Attributes)
 }
 
 // Intercept adds a handler for intercepting a given named event
@@ -46,66 +64,178 @@ func (e *Events) Intercept(name string, handler Handler) {
 	e.Handlers[name] = handler
 }
 
-// Handle handles a single event
+// Handle handles a single event. If an earlier event for the same
+// container is still being handled, e.g. a delayed "start", queues it
+// and returns right away; it is then handled after the earlier ones.
 func (e *Events) Handle(event *docker.APIEvents) {
-	if handler, ok := e.Handlers[event.Action]; ok {
-		handler(e.Log, e.Client, event).Do(e)
-	} else {
-		e.Emit(event)
+	e.interrupt(event)
+	if e.Sequence.Enter(event) {
+		e.handle(event)
+	}
+}
+
+// Same as Handle(), but not waiting for the event to be handled. Start
+// events which happened before their container was found by Running()
+// are skipped, it has been booted already.
+func (e *Events) dispatch(event *docker.APIEvents) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if listed, ok := e.listed[event.Actor.ID]; ok && event.Action == "start" && event.TimeNano <= listed {
+		return
+	}
+	e.interrupt(event)
+	if e.Sequence.Enter(event) {
+		go e.handle(event)
+	}
+}
+
+// Stops a container from waiting for others once it dies or is destroyed,
+// as the event would otherwise be queued behind its "start" indefinitely
+func (e *Events) interrupt(event *docker.APIEvents) {
+	if event.Action == "die" || event.Action == "destroy" {
+		e.Ready.Cancel(event.Actor.ID)
+	}
+}
+
+// Handles an event and all events queued for the same container meanwhile
+func (e *Events) handle(event *docker.APIEvents) {
+	for ; event != nil; event = e.Sequence.Leave(event) {
+		if handler, ok := e.Handlers[event.Action]; ok {
+			handler(e.Log, e.Client, event).Do(e)
+		} else {
+			e.Emit(event)
+		}
 	}
 }
 
 // Listen starts listening for events on the Docker API and passes them
-// to Handle() when they occur, not waiting for it to return.
-func (e *Events) Listen(done chan bool) {
-	events := make(chan *docker.APIEvents)
-	e.Client.AddEventListener(events)
-	defer e.Client.RemoveEventListener(events)
+// to Handle() when they occur, not waiting for it to return but keeping
+// them in order per container. If the Docker daemon closes the stream,
+// reconnects with exponential backoff, replaying the events since the
+// last one seen - or since the given time, if none was seen yet, so no
+// events are lost while connecting.
+func (e *Events) Listen(since time.Time, done chan bool) {
+	last := since.UnixNano()
+	seen := Recall(1000)
+	backoff := e.Backoff
+	for {
+		events := make(chan *docker.APIEvents, 100)
+		options := docker.EventsOptions{
+			Since: fmt.Sprintf("%d.%09d", last/int64(time.Second), last%int64(time.Second)),
+		}
+
+		if err := e.Client.AddEventListenerWithOptions(options, events); err != nil {
+			e.Log.Error("Subscribe error %s", err.Error())
+		} else if e.receive(events, &last, seen, &backoff, done) {
+			e.Client.RemoveEventListener(events)
+			return
+		}
 
+		e.Log.Warning("Lost connection to docker daemon, reconnecting in %s", backoff)
+		select {
+		case <-time.After(backoff):
+			e.Log.Info("Reconnecting, replaying events since %s", time.Unix(0, last).Format(time.RFC3339Nano))
+			if backoff *= 2; backoff > MAXBACKOFF {
+				backoff = MAXBACKOFF
+			}
+
+		case <-done:
+			return
+		}
+	}
+}
+
+// Receives events until the Docker daemon closes the stream, returning
+// false, or until done, returning true. Events already seen, e.g. when
+// replayed after reconnecting, are skipped; events may arrive out of order
+// though, so the time of the latest one is kept separately.
+func (e *Events) receive(events chan *docker.APIEvents, last *int64, seen *Seen, backoff *time.Duration, done chan bool) bool {
 	for {
 		select {
 		case event := <-events:
 			if event == nil {
 				e.Log.Info("Received EOF from docker daemon")
-				done <- true
-				return
+				return false
+			} else if !seen.Add(event) {
+				continue
+			}
+
+			if event.TimeNano > *last {
+				*last = event.TimeNano
 			}
-			go e.Handle(event)
+			*backoff = e.Backoff
+			e.dispatch(event)
 
 		case <-done:
-			return
+			return true
 		}
 	}
 }
 
-// ServeHTTP is the http.Handler implementation
+// ServeHTTP is the http.Handler implementation. Honors the "since", "until"
+// and "filters" query parameters, replaying remembered events only if one
+// of the former is given and closing the stream once the time given by
+// "until" is reached. Subscribes before replaying so no events are lost
+// in between, skipping those received twice.
 func (e *Events) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	var l sync.Mutex
-
-	listener := make(chan *docker.APIEvents)
+	filter, err := ParseFilter(r.URL.Query(), time.Now())
+	if err != nil {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"message": err.Error()})
+		return
+	}
 
-	l.Lock()
-	e.Listeners = append(e.Listeners, listener)
-	index := len(e.Listeners)
-	l.Unlock()
+	subscription := e.Listeners.Subscribe()
+	defer e.Listeners.Unsubscribe(subscription)
+	replay := make([]*docker.APIEvents, 0)
+	if filter.Replay {
+		replay = e.History.Matching(filter)
+	}
 
 	w.Header().Add("Content-Type", "application/json")
 	w.Header().Add("Transfer-Encoding", "chunked")
 	w.WriteHeader(http.StatusOK)
 
 	if f, ok := w.(http.Flusher); ok {
+		replayed := make(map[*docker.APIEvents]bool)
+		for _, event := range replay {
+			bytes, _ := json.Marshal(event)
+			if _, err := w.Write(bytes); err != nil {
+				return
+			}
+			replayed[event] = true
+		}
+		f.Flush()
+
+		var until <-chan time.Time
+		if filter.Until != math.MaxInt64 {
+			until = time.After(time.Until(time.Unix(0, filter.Until)))
+		}
+
 		for {
 			select {
-			case event := <-listener:
+			case event := <-subscription.Events:
+				if replayed[event] || !filter.Match(event) {
+					continue
+				}
+
 				bytes, _ := json.Marshal(event)
 				if _, err := w.Write(bytes); err != nil {
-					l.Lock()
-					e.Listeners = append(e.Listeners[:index-1], e.Listeners[index:]...)
-					l.Unlock()
 					return
 				}
 
 				f.Flush()
+
+			case <-until:
+				return
+
+			case <-subscription.Done:
+				return
+
+			case <-r.Context().Done():
+				return
 			}
 		}
 	}
@@ -1,14 +1,23 @@
 package events
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/fsouza/go-dockerclient"
 	"github.com/tueftler/boot/output"
 )
 
 const CONTAINER = "610036617aa165161127bc0cec60ae7831fdc1ddf1fdef1fb7f246cc83b0c315"
+const DATABASE = "b0c3156100367aa165161127bc0cec60ae7831fdc1ddf1fdef1fb7f246cc8361"
+const CACHE = "c0cec60ae7831fdc1ddf1fdef1fb7f246cc83b0c315610036617aa165161127b"
 
 func assertEqual(expect, actual interface{}, t *testing.T) {
 	if !reflect.DeepEqual(expect, actual) {
@@ -69,3 +78,929 @@ func Test_handle_drop(t *testing.T) {
 
 	assertEqual("", written, t)
 }
+
+func started(id, name string) *docker.APIEvents {
+	return &docker.APIEvents{Action: "start", Actor: docker.APIActor{ID: id, Attributes: map[string]string{"name": name}}}
+}
+
+func Test_names(t *testing.T) {
+	event := started(CONTAINER, "app_db_1")
+	event.Actor.Attributes["com.docker.compose.project"] = "app"
+	event.Actor.Attributes["com.docker.compose.service"] = "db"
+
+	assertEqual([]string{CONTAINER, "app_db_1", "app_db"}, Names(event), t)
+}
+
+// Returns a start event for a container started by Docker Compose
+func composed(id, project, service string) *docker.APIEvents {
+	event := started(id, project+"_"+service+"_1")
+	event.Actor.Attributes["com.docker.compose.project"] = project
+	event.Actor.Attributes["com.docker.compose.service"] = service
+	return event
+}
+
+func Test_wait_for_service_in_same_project(t *testing.T) {
+	fixture := Track()
+	fixture.Update(composed(DATABASE, "other", "db"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := fixture.Wait(ctx, composed(CONTAINER, "app", "web"), []string{"db"})
+	assertEqual("Waiting for db: context deadline exceeded", err.Error(), t)
+
+	fixture.Update(composed(CACHE, "app", "db"))
+	assertEqual(nil, fixture.Wait(context.Background(), composed(CONTAINER, "app", "web"), []string{"db"}), t)
+}
+
+func Test_wait_for_service_in_other_project(t *testing.T) {
+	fixture := Track()
+	fixture.Update(composed(DATABASE, "other", "db"))
+
+	assertEqual(nil, fixture.Wait(context.Background(), composed(CONTAINER, "app", "web"), []string{"other_db"}), t)
+}
+
+func Test_emit_marks_ready(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	fixture.Emit(started(CONTAINER, "db"))
+
+	assertEqual(true, fixture.Ready.Ready("db"), t)
+	assertEqual(true, fixture.Ready.Ready(CONTAINER), t)
+}
+
+func Test_emit_die_marks_not_ready(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	fixture.Emit(started(CONTAINER, "db"))
+	fixture.Emit(&docker.APIEvents{Action: "die", Actor: docker.APIActor{ID: CONTAINER}})
+
+	assertEqual(false, fixture.Ready.Ready("db"), t)
+}
+
+func Test_wait_for_ready(t *testing.T) {
+	fixture := Track()
+	fixture.Update(started(DATABASE, "db"))
+
+	err := fixture.Wait(context.Background(), started(CONTAINER, "app"), []string{"db"})
+	assertEqual(nil, err, t)
+}
+
+func Test_wait_until_ready(t *testing.T) {
+	fixture := Track()
+	done := make(chan error)
+	go func() {
+		done <- fixture.Wait(context.Background(), started(CONTAINER, "app"), []string{"db", "cache"})
+	}()
+
+	fixture.Update(started(DATABASE, "db"))
+	fixture.Update(started(CACHE, "cache"))
+	assertEqual(nil, <-done, t)
+}
+
+func Test_wait_timeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := Track().Wait(ctx, started(CONTAINER, "app"), []string{"db"})
+	assertEqual("Waiting for db: context deadline exceeded", err.Error(), t)
+}
+
+func Test_wait_cycle(t *testing.T) {
+	fixture := Track()
+	go fixture.Wait(context.Background(), started(DATABASE, "db"), []string{"app"})
+	for {
+		fixture.lock.Lock()
+		waiting := len(fixture.waiting)
+		fixture.lock.Unlock()
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	err := fixture.Wait(context.Background(), started(CONTAINER, "app"), []string{"db"})
+	assertEqual("Dependency cycle "+CONTAINER+" -> db -> app", err.Error(), t)
+}
+
+func Test_wait_self(t *testing.T) {
+	err := Track().Wait(context.Background(), started(CONTAINER, "app"), []string{"app"})
+	assertEqual("Dependency cycle "+CONTAINER+" -> app", err.Error(), t)
+}
+
+func Test_handle_after(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	fixture.Intercept("start", func(log *output.Stream, client *docker.Client, event *docker.APIEvents) Action {
+		if event.Actor.ID != CONTAINER {
+			return &Emit{Event: event}
+		}
+		return &After{Event: event, Log: log, Depends: []string{"db"}, Then: func(err error) Action {
+			return &Emit{Event: event}
+		}}
+	})
+
+	done := make(chan bool)
+	go func() {
+		fixture.Handle(started(CONTAINER, "app"))
+		done <- true
+	}()
+	time.Sleep(10 * time.Millisecond)
+	assertEqual(false, fixture.Ready.Ready("app"), t)
+
+	fixture.Handle(started(DATABASE, "db"))
+	<-done
+	assertEqual(true, fixture.Ready.Ready("app"), t)
+}
+
+func Test_handle_after_timeout(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	fixture.Intercept("start", func(log *output.Stream, client *docker.Client, event *docker.APIEvents) Action {
+		return &After{Event: event, Log: log, Depends: []string{"db"}, Timeout: time.Millisecond, Then: func(err error) Action {
+			if err != nil {
+				return &Drop{}
+			}
+			return &Emit{Event: event}
+		}}
+	})
+	fixture.Handle(started(CONTAINER, "app"))
+
+	assertEqual(false, fixture.Ready.Ready("app"), t)
+}
+
+func Test_handle_after_die(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	fixture.Intercept("start", func(log *output.Stream, client *docker.Client, event *docker.APIEvents) Action {
+		return &After{Event: event, Log: log, Depends: []string{"db"}, Then: func(err error) Action {
+			if err != nil {
+				return &Drop{}
+			}
+			return &Emit{Event: event}
+		}}
+	})
+
+	done := make(chan bool)
+	go func() {
+		fixture.Handle(started(CONTAINER, "app"))
+		done <- true
+	}()
+	for {
+		fixture.Ready.lock.Lock()
+		waiting := len(fixture.Ready.waiting)
+		fixture.Ready.lock.Unlock()
+		if waiting > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	fixture.Handle(at("die", CONTAINER, 1480000000, nil))
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected waiting to be canceled")
+	}
+	assertEqual([]string{"die 610"}, received(subscription, 1), t)
+	assertEqual(0, len(fixture.Ready.waiting), t)
+}
+
+// Intercepts "start" events for CONTAINER, blocking until released
+func delayed(fixture *Events, intercepted, release chan bool) {
+	fixture.Intercept("start", func(log *output.Stream, client *docker.Client, event *docker.APIEvents) Action {
+		if event.Actor.ID == CONTAINER {
+			intercepted <- true
+			<-release
+		}
+		return &Emit{Event: event}
+	})
+}
+
+// Returns the actions and shortened IDs of the given number of received events
+func received(subscription *Subscription, count int) []string {
+	actions := make([]string, count)
+	for i := range actions {
+		event := <-subscription.Events
+		actions[i] = event.Action + " " + event.Actor.ID[0:3]
+	}
+	return actions
+}
+
+func Test_handle_keeps_order_per_container(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	intercepted, release := make(chan bool), make(chan bool)
+	delayed(fixture, intercepted, release)
+
+	done := make(chan bool)
+	go func() {
+		fixture.Handle(at("start", CONTAINER, 1, nil))
+		done <- true
+	}()
+	<-intercepted
+
+	fixture.Handle(at("die", CONTAINER, 2, nil))
+	fixture.Handle(at("start", DATABASE, 3, nil))
+	fixture.Handle(at("die", DATABASE, 4, nil))
+	assertEqual(1, fixture.Sequence.Pending(), t)
+
+	close(release)
+	<-done
+	assertEqual([]string{"start b0c", "die b0c", "start 610", "die 610"}, received(subscription, 4), t)
+	assertEqual(0, fixture.Sequence.Pending(), t)
+}
+
+func Test_handle_intercepts_queued(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	intercepted, release := make(chan bool), make(chan bool)
+	delayed(fixture, intercepted, release)
+	fixture.Intercept("die", func(log *output.Stream, client *docker.Client, event *docker.APIEvents) Action {
+		return &Drop{}
+	})
+
+	done := make(chan bool)
+	go func() {
+		fixture.Handle(at("start", CONTAINER, 1, nil))
+		done <- true
+	}()
+	<-intercepted
+
+	fixture.Handle(at("die", CONTAINER, 2, nil))
+	fixture.Handle(at("destroy", CONTAINER, 3, nil))
+	close(release)
+	<-done
+	assertEqual([]string{"start 610", "destroy 610"}, received(subscription, 2), t)
+}
+
+func Test_synthesize(t *testing.T) {
+	now := time.Unix(1480000000, 0)
+	event := Synthesize(docker.APIContainers{
+		ID:     CONTAINER,
+		Image:  "nginx",
+		Names:  []string{"/web"},
+		Labels: map[string]string{"boot": "/boot.sh"},
+	}, now)
+
+	assertEqual("start", event.Action, t)
+	assertEqual("container", event.Type, t)
+	assertEqual(CONTAINER, event.Actor.ID, t)
+	assertEqual(map[string]string{"image": "nginx", "name": "web", "boot": "/boot.sh"}, event.Actor.Attributes, t)
+	assertEqual(int64(1480000000), event.Time, t)
+}
+
+// Returns a client for a fake Docker daemon listing a running container
+func listing(t *testing.T) (*docker.Client, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `[{"Id": "%s", "Image": "nginx", "Names": ["/web"]}]`, CONTAINER)
+	}))
+	client, err := docker.NewClient(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, server.Close
+}
+
+func unknown(id string) bool {
+	return false
+}
+
+func Test_running(t *testing.T) {
+	client, stop := listing(t)
+	defer stop()
+
+	handled := make(chan *docker.APIEvents)
+	fixture := Distribute(client, output.NewStream("", func(arg string) {}))
+	fixture.Intercept("start", func(log *output.Stream, client *docker.Client, event *docker.APIEvents) Action {
+		handled <- event
+		return &Emit{Event: event}
+	})
+
+	if err := fixture.Running(unknown); err != nil {
+		t.Error(err)
+	}
+	assertEqual(CONTAINER, (<-handled).Actor.ID, t)
+}
+
+func Test_running_skips_known(t *testing.T) {
+	client, stop := listing(t)
+	defer stop()
+
+	fixture := Distribute(client, output.NewStream("", func(arg string) {}))
+	if err := fixture.Running(func(id string) bool { return id == CONTAINER }); err != nil {
+		t.Error(err)
+	}
+	assertEqual(0, fixture.Sequence.Pending(), t)
+}
+
+func Test_running_skips_busy(t *testing.T) {
+	client, stop := listing(t)
+	defer stop()
+
+	fixture := Distribute(client, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	intercepted, release := make(chan bool), make(chan bool)
+	delayed(fixture, intercepted, release)
+	fixture.dispatch(started(CONTAINER, "web"))
+	<-intercepted
+
+	if err := fixture.Running(unknown); err != nil {
+		t.Error(err)
+	}
+	close(release)
+	for fixture.Sequence.Pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assertEqual(1, len(subscription.Events), t)
+}
+
+func Test_running_skips_earlier_start(t *testing.T) {
+	client, stop := listing(t)
+	defer stop()
+
+	handled := make(chan int64, 3)
+	fixture := Distribute(client, output.NewStream("", func(arg string) {}))
+	fixture.Intercept("start", func(log *output.Stream, client *docker.Client, event *docker.APIEvents) Action {
+		handled <- event.TimeNano
+		return &Drop{}
+	})
+
+	before, after := time.Now().Add(-time.Second), time.Now().Add(time.Second)
+	if err := fixture.Running(unknown); err != nil {
+		t.Error(err)
+	}
+	<-handled
+
+	fixture.dispatch(at("start", CONTAINER, before.Unix(), nil))
+	fixture.dispatch(at("start", CONTAINER, after.Unix(), nil))
+	assertEqual(after.Unix()*int64(time.Second), <-handled, t)
+	assertEqual(0, len(handled), t)
+}
+
+// Formats a time in nanoseconds the way it is passed as "since"
+func since(nano int64) string {
+	return fmt.Sprintf("%d.%09d", nano/int64(time.Second), nano%int64(time.Second))
+}
+
+func Test_listen_reconnects(t *testing.T) {
+	first, second := time.Now().Add(time.Second).UnixNano(), time.Now().Add(2*time.Second).UnixNano()
+	requested := make(chan string, 100)
+	requests := 0
+	var lock sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- r.URL.Query().Get("since"):
+		default:
+		}
+
+		lock.Lock()
+		requests++
+		replay := requests > 1
+		lock.Unlock()
+
+		fmt.Fprintf(w, `{"Action": "start", "Actor": {"ID": "%s"}, "time": %d, "timeNano": %d}`, CONTAINER, first/int64(time.Second), first)
+		if replay {
+			fmt.Fprintf(w, `{"Action": "start", "Actor": {"ID": "%s"}, "time": %d, "timeNano": %d}`, DATABASE, second/int64(time.Second), second)
+		}
+	}))
+	defer server.Close()
+	client, _ := docker.NewClient(server.URL)
+
+	handled := make(chan string, 100)
+	fixture := Distribute(client, output.NewStream("", func(arg string) {}))
+	fixture.Backoff = time.Millisecond
+	fixture.Intercept("start", func(log *output.Stream, client *docker.Client, event *docker.APIEvents) Action {
+		handled <- event.Actor.ID
+		return &Drop{}
+	})
+
+	done := make(chan bool)
+	go fixture.Listen(time.Now(), done)
+	defer func() { done <- true }()
+
+	ids := make(map[string]int)
+	for len(ids) < 2 {
+		select {
+		case id := <-handled:
+			ids[id]++
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected both containers to be handled, have %v", ids)
+		}
+	}
+
+	for value, expect := "", since(second); value != expect; {
+		select {
+		case value = <-requested:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected reconnect since %s", expect)
+		}
+	}
+
+	assertEqual(map[string]int{CONTAINER: 1, DATABASE: 1}, ids, t)
+	assertEqual(0, len(handled), t)
+}
+
+func Test_listen_since(t *testing.T) {
+	requested := make(chan string, 100)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- r.URL.Query().Get("since"):
+		default:
+		}
+	}))
+	defer server.Close()
+	client, _ := docker.NewClient(server.URL)
+
+	fixture := Distribute(client, output.NewStream("", func(arg string) {}))
+	fixture.Backoff = time.Millisecond
+
+	before := time.Now()
+	done := make(chan bool)
+	go fixture.Listen(before, done)
+	defer func() { done <- true }()
+
+	select {
+	case value := <-requested:
+		assertEqual(since(before.UnixNano()), value, t)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a request")
+	}
+}
+
+func Test_receive_out_of_order(t *testing.T) {
+	handled := make(chan string, 3)
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	fixture.Intercept("start", func(log *output.Stream, client *docker.Client, event *docker.APIEvents) Action {
+		handled <- event.Actor.ID
+		return &Drop{}
+	})
+
+	events := make(chan *docker.APIEvents, 4)
+	events <- at("start", DATABASE, 1480000001, nil)
+	events <- at("start", CONTAINER, 1480000000, nil)
+	events <- at("start", DATABASE, 1480000001, nil)
+	events <- nil
+
+	last, backoff := int64(0), time.Second
+	assertEqual(false, fixture.receive(events, &last, Recall(10), &backoff, make(chan bool)), t)
+	assertEqual(int64(1480000001000000000), last, t)
+
+	ids := map[string]bool{<-handled: true, <-handled: true}
+	for fixture.Sequence.Pending() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	assertEqual(map[string]bool{CONTAINER: true, DATABASE: true}, ids, t)
+	assertEqual(0, len(handled), t)
+}
+
+func Test_seen(t *testing.T) {
+	fixture := Recall(2)
+
+	assertEqual(true, fixture.Add(at("start", CONTAINER, 1, nil)), t)
+	assertEqual(true, fixture.Add(at("start", DATABASE, 1, nil)), t)
+	assertEqual(false, fixture.Add(at("start", CONTAINER, 1, nil)), t)
+	assertEqual(true, fixture.Add(at("die", CONTAINER, 1, nil)), t)
+	assertEqual(true, fixture.Add(at("start", CONTAINER, 1, nil)), t)
+}
+
+func at(action, id string, seconds int64, attributes map[string]string) *docker.APIEvents {
+	return &docker.APIEvents{
+		Type:     "container",
+		Action:   action,
+		Actor:    docker.APIActor{ID: id, Attributes: attributes},
+		Time:     seconds,
+		TimeNano: seconds * int64(time.Second),
+	}
+}
+
+func filter(query string, t *testing.T) *Filter {
+	values, _ := url.ParseQuery(query)
+	filter, err := ParseFilter(values, time.Unix(1480000600, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filter
+}
+
+func Test_filter_since_timestamp(t *testing.T) {
+	assertEqual(int64(1480000000500000000), filter("since=1480000000.5", t).Since, t)
+}
+
+func Test_filter_since_duration(t *testing.T) {
+	assertEqual(int64(1480000000000000000), filter("since=10m", t).Since, t)
+}
+
+func Test_filter_until_rfc3339(t *testing.T) {
+	assertEqual(int64(1480000000000000000), filter("until=2016-11-24T15:06:40Z", t).Until, t)
+}
+
+func Test_filter_invalid_since(t *testing.T) {
+	if _, err := ParseFilter(url.Values{"since": {"yesterday"}}, time.Now()); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_filter_invalid_filters(t *testing.T) {
+	if _, err := ParseFilter(url.Values{"filters": {"{type}"}}, time.Now()); err == nil {
+		t.Error("Expected an error")
+	}
+}
+
+func Test_filter_replay(t *testing.T) {
+	assertEqual(false, filter("", t).Replay, t)
+	assertEqual(false, filter(`filters={"event":["start"]}`, t).Replay, t)
+	assertEqual(true, filter("since=1480000000", t).Replay, t)
+	assertEqual(true, filter("until=1480000000", t).Replay, t)
+}
+
+func Test_filter_legacy_format(t *testing.T) {
+	assertEqual(map[string][]string{"event": {"start"}}, filter(`filters={"event":{"start":true}}`, t).Filters, t)
+}
+
+func Test_filter_match_time(t *testing.T) {
+	fixture := filter("since=1480000000&until=1480000010", t)
+
+	assertEqual(false, fixture.Match(at("start", CONTAINER, 1479999999, nil)), t)
+	assertEqual(true, fixture.Match(at("start", CONTAINER, 1480000005, nil)), t)
+	assertEqual(false, fixture.Match(at("start", CONTAINER, 1480000011, nil)), t)
+}
+
+func Test_filter_match_event(t *testing.T) {
+	fixture := filter(`filters={"event":["start","die"]}`, t)
+
+	assertEqual(true, fixture.Match(at("start", CONTAINER, 1, nil)), t)
+	assertEqual(true, fixture.Match(at("die", CONTAINER, 1, nil)), t)
+	assertEqual(false, fixture.Match(at("stop", CONTAINER, 1, nil)), t)
+}
+
+func Test_filter_match_type(t *testing.T) {
+	event := at("create", CONTAINER, 1, nil)
+	event.Type = "network"
+
+	assertEqual(false, filter(`filters={"type":["container"]}`, t).Match(event), t)
+	assertEqual(true, filter(`filters={"type":["network"]}`, t).Match(event), t)
+}
+
+func Test_filter_match_container(t *testing.T) {
+	event := at("start", CONTAINER, 1, map[string]string{"name": "web"})
+
+	assertEqual(true, filter(`filters={"container":["web"]}`, t).Match(event), t)
+	assertEqual(true, filter(`filters={"container":["610036617aa1"]}`, t).Match(event), t)
+	assertEqual(false, filter(`filters={"container":["db"]}`, t).Match(event), t)
+}
+
+func Test_filter_match_image(t *testing.T) {
+	event := at("start", CONTAINER, 1, map[string]string{"image": "registry:5000/nginx:1.11"})
+
+	assertEqual(true, filter(`filters={"image":["registry:5000/nginx"]}`, t).Match(event), t)
+	assertEqual(true, filter(`filters={"image":["registry:5000/nginx:1.11"]}`, t).Match(event), t)
+	assertEqual(false, filter(`filters={"image":["nginx"]}`, t).Match(event), t)
+}
+
+func Test_filter_match_label(t *testing.T) {
+	event := at("start", CONTAINER, 1, map[string]string{"boot": "/boot.sh", "env": "prod"})
+
+	assertEqual(true, filter(`filters={"label":["boot"]}`, t).Match(event), t)
+	assertEqual(true, filter(`filters={"label":["boot","env=prod"]}`, t).Match(event), t)
+	assertEqual(false, filter(`filters={"label":["boot","env=dev"]}`, t).Match(event), t)
+}
+
+func Test_history(t *testing.T) {
+	fixture := Remember(2)
+	fixture.Add(at("create", CONTAINER, 1, nil))
+	fixture.Add(at("start", CONTAINER, 2, nil))
+	fixture.Add(at("die", CONTAINER, 3, nil))
+
+	actions := make([]string, 0)
+	for _, event := range fixture.Matching(filter("", t)) {
+		actions = append(actions, event.Action)
+	}
+	assertEqual([]string{"start", "die"}, actions, t)
+}
+
+func Test_serve_replays_until(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	fixture.Emit(at("start", CONTAINER, 1480000000, nil))
+	fixture.Emit(at("start", DATABASE, 1480000005, nil))
+	fixture.Emit(at("die", DATABASE, 1480000010, nil))
+
+	response := httptest.NewRecorder()
+	fixture.ServeHTTP(response, httptest.NewRequest("GET", `/events?since=1480000001&until=1480000020&filters={"event":["start"]}`, nil))
+
+	assertEqual(http.StatusOK, response.Code, t)
+	assertEqual(`{"action":"start","type":"container","actor":{"id":"`+DATABASE+`"},"time":1480000005,"timeNano":1480000005000000000}`, response.Body.String(), t)
+	assertEqual(0, fixture.Listeners.Count(), t)
+}
+
+func Test_serve_without_since_replays_nothing(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	fixture.Emit(at("start", CONTAINER, 1480000000, nil))
+	fixture.Emit(at("die", CONTAINER, 1480000005, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	response := httptest.NewRecorder()
+	served := make(chan bool)
+	go func() {
+		fixture.ServeHTTP(response, httptest.NewRequest("GET", "/events", nil).WithContext(ctx))
+		served <- true
+	}()
+	for fixture.Listeners.Count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-served
+	assertEqual("", response.Body.String(), t)
+}
+
+func Test_serve_invalid_filter(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+
+	response := httptest.NewRecorder()
+	fixture.ServeHTTP(response, httptest.NewRequest("GET", "/events?since=yesterday", nil))
+
+	assertEqual(http.StatusBadRequest, response.Code, t)
+	assertEqual("{\"message\":\"Invalid since 'yesterday': expected timestamp, RFC 3339 date or duration\"}\n", response.Body.String(), t)
+}
+
+func Test_subscribe(t *testing.T) {
+	fixture := Register(0, BLOCK, output.NewStream("", func(arg string) {}))
+	fixture.Subscribe()
+
+	assertEqual(1, fixture.Count(), t)
+}
+
+func Test_unsubscribe(t *testing.T) {
+	fixture := Register(0, BLOCK, output.NewStream("", func(arg string) {}))
+	first := fixture.Subscribe()
+	second := fixture.Subscribe()
+	fixture.Unsubscribe(first)
+
+	assertEqual(1, fixture.Count(), t)
+	go fixture.Send(at("start", CONTAINER, 1, nil))
+	assertEqual(CONTAINER, (<-second.Events).Actor.ID, t)
+}
+
+func Test_unsubscribe_twice(t *testing.T) {
+	fixture := Register(0, BLOCK, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Subscribe()
+	fixture.Unsubscribe(subscription)
+	fixture.Unsubscribe(subscription)
+
+	assertEqual(0, fixture.Count(), t)
+}
+
+func Test_unsubscribe_cancels_blocked_send(t *testing.T) {
+	fixture := Register(0, BLOCK, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Subscribe()
+
+	sent := make(chan int)
+	go func() {
+		sent <- fixture.Send(at("start", CONTAINER, 1, nil))
+	}()
+	fixture.Unsubscribe(subscription)
+
+	<-sent
+	assertEqual(0, fixture.Count(), t)
+}
+
+func Test_concurrent_subscriptions(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+
+	var wait sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			subscription := fixture.Listeners.Subscribe()
+			defer fixture.Listeners.Unsubscribe(subscription)
+
+			select {
+			case <-subscription.Events:
+			case <-time.After(time.Millisecond):
+			}
+		}()
+	}
+
+	for i := 0; i < 10; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			fixture.Listeners.Send(at("start", CONTAINER, 1, nil))
+		}()
+	}
+
+	wait.Wait()
+	assertEqual(0, fixture.Listeners.Count(), t)
+}
+
+func Test_serve_client_disconnect(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan bool)
+	go func() {
+		fixture.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events", nil).WithContext(ctx))
+		served <- true
+	}()
+	for fixture.Listeners.Count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	<-served
+	assertEqual(0, fixture.Listeners.Count(), t)
+}
+
+func Test_send_drops_oldest(t *testing.T) {
+	written := ""
+	fixture := Register(2, DROP, output.NewStream("> ", func(arg string) { written += arg }))
+	subscription := fixture.Subscribe()
+
+	fixture.Send(at("create", CONTAINER, 1, nil))
+	fixture.Send(at("start", CONTAINER, 2, nil))
+	fixture.Send(at("die", CONTAINER, 3, nil))
+
+	assertEqual("start", (<-subscription.Events).Action, t)
+	assertEqual("die", (<-subscription.Events).Action, t)
+	assertEqual(int64(1), subscription.Dropped(), t)
+	assertEqual("> "+output.Text("warning", "Queue for listener #1 full, dropped create event (1 so far)")+"\n", written, t)
+}
+
+func Test_send_disconnects(t *testing.T) {
+	fixture := Register(1, DISCONNECT, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Subscribe()
+
+	fixture.Send(at("create", CONTAINER, 1, nil))
+	fixture.Send(at("start", CONTAINER, 2, nil))
+
+	select {
+	case <-subscription.Done:
+	default:
+		t.Error("Expected subscription to be disconnected")
+	}
+	assertEqual(int64(1), subscription.Dropped(), t)
+}
+
+func Test_send_does_not_block_on_slow_listener(t *testing.T) {
+	fixture := Register(1, DROP, output.NewStream("", func(arg string) {}))
+	fixture.Subscribe()
+	fast := fixture.Subscribe()
+
+	for i := int64(1); i <= 3; i++ {
+		fixture.Send(at("start", CONTAINER, i, nil))
+		assertEqual(i, (<-fast.Events).Time, t)
+	}
+}
+
+func Test_send_blocks(t *testing.T) {
+	fixture := Register(1, BLOCK, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Subscribe()
+	fixture.Send(at("create", CONTAINER, 1, nil))
+
+	sent := make(chan bool)
+	go func() {
+		fixture.Send(at("start", CONTAINER, 2, nil))
+		sent <- true
+	}()
+
+	select {
+	case <-sent:
+		t.Error("Expected send to block")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	<-subscription.Events
+	<-sent
+	assertEqual(int64(0), subscription.Dropped(), t)
+}
+
+func Test_serve_disconnected(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	fixture.Listeners.Size = 1
+	fixture.Listeners.Policy = DISCONNECT
+	writer := &stalled{httptest.NewRecorder(), make(chan bool)}
+
+	served := make(chan bool)
+	go func() {
+		fixture.ServeHTTP(writer, httptest.NewRequest("GET", "/events", nil))
+		served <- true
+	}()
+	for fixture.Listeners.Count() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := int64(1); i <= 3; i++ {
+		fixture.Emit(at("start", CONTAINER, i, nil))
+	}
+	close(writer.release)
+	<-served
+	assertEqual(0, fixture.Listeners.Count(), t)
+}
+
+// A response writer which blocks writing until released
+type stalled struct {
+	*httptest.ResponseRecorder
+	release chan bool
+}
+
+func (s *stalled) Write(p []byte) (int, error) {
+	<-s.release
+	return s.ResponseRecorder.Write(p)
+}
+
+func Test_lifecycle(t *testing.T) {
+	event := Lifecycle(at("start", CONTAINER, 1, map[string]string{"name": "web"}), "boot:ready", map[string]string{"attempts": "2"})
+
+	assertEqual("container", event.Type, t)
+	assertEqual("boot:ready", event.Action, t)
+	assertEqual(CONTAINER, event.Actor.ID, t)
+	assertEqual(map[string]string{"name": "web", "attempts": "2"}, event.Actor.Attributes, t)
+}
+
+func Test_booting(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	event := at("start", CONTAINER, 1, nil)
+	(&Booting{Event: event, Then: func() Action { return &Emit{Event: event} }}).Do(fixture)
+
+	assertEqual([]string{"boot:start 610", "start 610"}, received(subscription, 2), t)
+}
+
+func Test_ready(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	(&Ready{Event: at("start", CONTAINER, 1, nil), Attempts: 2, Duration: 1500 * time.Millisecond}).Do(fixture)
+
+	assertEqual("start", (<-subscription.Events).Action, t)
+	assertEqual(map[string]string{"exitCode": "0", "duration": "1.5s", "attempts": "2"}, (<-subscription.Events).Actor.Attributes, t)
+	assertEqual(true, fixture.Ready.Ready(CONTAINER), t)
+}
+
+func Test_failed(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	(&Failed{Event: at("start", CONTAINER, 1, nil), Attempts: 3, ExitCode: 1, Duration: time.Second, Reason: "Non-zero exit code 1"}).Do(fixture)
+
+	event := <-subscription.Events
+	assertEqual("boot:failed", event.Action, t)
+	assertEqual(map[string]string{"exitCode": "1", "duration": "1s", "attempts": "3", "reason": "Non-zero exit code 1"}, event.Actor.Attributes, t)
+	assertEqual(false, fixture.Ready.Ready(CONTAINER), t)
+}
+
+// Returns a client for a fake Docker daemon recording the requests made
+func recording(requests chan string) (*docker.Client, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	client, _ := docker.NewClient(server.URL)
+	return client, server.Close
+}
+
+func Test_failure_actions(t *testing.T) {
+	requests := make(chan string, 1)
+	client, stop := recording(requests)
+	defer stop()
+
+	fixture := Distribute(client, output.NewStream("", func(arg string) {}))
+	event := at("start", CONTAINER, 1, nil)
+	log := output.NewStream("", func(arg string) {})
+
+	(&Stop{Event: event, Log: log}).Do(fixture)
+	assertEqual("POST /containers/"+CONTAINER+"/stop?t=10", <-requests, t)
+
+	(&Restart{Event: event, Log: log}).Do(fixture)
+	assertEqual("POST /containers/"+CONTAINER+"/restart?t=10", <-requests, t)
+
+	(&Kill{Event: event, Log: log}).Do(fixture)
+	assertEqual("POST /containers/"+CONTAINER+"/kill?", <-requests, t)
+}
+
+func Test_failed_then(t *testing.T) {
+	requests := make(chan string, 1)
+	client, stop := recording(requests)
+	defer stop()
+
+	fixture := Distribute(client, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	event := at("start", CONTAINER, 1, nil)
+	(&Failed{Event: event, Then: &Stop{Event: event, Log: fixture.Log}}).Do(fixture)
+
+	assertEqual("boot:failed", (<-subscription.Events).Action, t)
+	assertEqual("POST /containers/"+CONTAINER+"/stop?t=10", <-requests, t)
+}
+
+func Test_announce(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	event := at("kill", CONTAINER, 1, nil)
+	(&Announce{Event: event, Action: "boot:drain", Then: func() Action { return &Emit{Event: event} }}).Do(fixture)
+
+	assertEqual([]string{"boot:drain 610", "kill 610"}, received(subscription, 2), t)
+}
+
+func Test_failed_then_emit(t *testing.T) {
+	fixture := Distribute(nil, output.NewStream("", func(arg string) {}))
+	subscription := fixture.Listeners.Subscribe()
+	event := at("start", CONTAINER, 1, nil)
+	(&Failed{Event: event, ExitCode: 1, Then: &Emit{Event: event}}).Do(fixture)
+
+	assertEqual([]string{"boot:failed 610", "start 610"}, received(subscription, 2), t)
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tueftler/boot/output"
+)
+
+// Seconds to wait for a container to stop before killing it
+const STOPTIMEOUT = 10
+
+type Stop struct {
+	Event *docker.APIEvents
+	Log   *output.Stream
+}
+
+type Restart struct {
+	Event *docker.APIEvents
+	Log   *output.Stream
+}
+
+type Kill struct {
+	Event *docker.APIEvents
+	Log   *output.Stream
+}
+
+// Do drops the event and stops its container, killing it if it does not
+// stop within STOPTIMEOUT seconds
+func (s *Stop) Do(events *Events) {
+	s.Log.Warning("Stopping container")
+	if err := events.Client.StopContainer(s.Event.Actor.ID, STOPTIMEOUT); err != nil {
+		s.Log.Error("Stop error %s", err.Error())
+	}
+}
+
+// Do drops the event and restarts its container, which will then cause
+// another start event
+func (r *Restart) Do(events *Events) {
+	r.Log.Warning("Restarting container")
+	if err := events.Client.RestartContainer(r.Event.Actor.ID, STOPTIMEOUT); err != nil {
+		r.Log.Error("Restart error %s", err.Error())
+	}
+}
+
+// Do drops the event and kills its container
+func (k *Kill) Do(events *Events) {
+	k.Log.Warning("Killing container")
+	if err := events.Client.KillContainer(docker.KillContainerOptions{ID: k.Event.Actor.ID}); err != nil {
+		k.Log.Error("Kill error %s", err.Error())
+	}
+}
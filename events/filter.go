@@ -0,0 +1,197 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+type Filter struct {
+	Since   int64
+	Until   int64
+	Filters map[string][]string
+	Replay  bool
+}
+
+// ParseFilter parses the "since", "until" and "filters" query parameters
+// the way the Docker API does. Timestamps may be given as Unix timestamps
+// with optional fractional seconds, in RFC 3339 format or as durations
+// relative to now, e.g. "10m". Past events are only to be replayed if
+// either "since" or "until" is given.
+func ParseFilter(query url.Values, now time.Time) (*Filter, error) {
+	filter := &Filter{Since: 0, Until: math.MaxInt64, Filters: make(map[string][]string)}
+
+	var err error
+	filter.Replay = query.Get("since") != "" || query.Get("until") != ""
+	if value := query.Get("since"); value != "" {
+		if filter.Since, err = timestamp(value, now); err != nil {
+			return nil, fmt.Errorf("Invalid since '%s': %s", value, err.Error())
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if filter.Until, err = timestamp(value, now); err != nil {
+			return nil, fmt.Errorf("Invalid until '%s': %s", value, err.Error())
+		}
+	}
+
+	if value := query.Get("filters"); value != "" {
+		if err := json.Unmarshal([]byte(value), &filter.Filters); err != nil {
+
+			// Older clients send {"key": {"value": true}}
+			legacy := make(map[string]map[string]bool)
+			if json.Unmarshal([]byte(value), &legacy) != nil {
+				return nil, fmt.Errorf("Invalid filters '%s': %s", value, err.Error())
+			}
+
+			filter.Filters = make(map[string][]string)
+			for key, values := range legacy {
+				for value, enabled := range values {
+					if enabled {
+						filter.Filters[key] = append(filter.Filters[key], value)
+					}
+				}
+			}
+		}
+	}
+
+	return filter, nil
+}
+
+// Parses a timestamp into nanoseconds
+func timestamp(value string, now time.Time) (int64, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration).UnixNano(), nil
+	}
+
+	if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return parsed.UnixNano(), nil
+	}
+
+	parts := strings.SplitN(value, ".", 2)
+	seconds, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("expected timestamp, RFC 3339 date or duration")
+	}
+
+	nanos := int64(0)
+	if len(parts) > 1 {
+		fraction := (parts[1] + "000000000")[0:9]
+		if nanos, err = strconv.ParseInt(fraction, 10, 64); err != nil {
+			return 0, fmt.Errorf("expected fractional seconds")
+		}
+	}
+	return seconds*int64(time.Second) + nanos, nil
+}
+
+// Time returns an event's time in nanoseconds
+func Time(event *docker.APIEvents) int64 {
+	if event.TimeNano != 0 {
+		return event.TimeNano
+	}
+	return event.Time * int64(time.Second)
+}
+
+// Match returns whether an event matches this filter. Values given for
+// the same key are OR'ed - except for labels, which all need to match -
+// different keys are AND'ed.
+func (f *Filter) Match(event *docker.APIEvents) bool {
+	if at := Time(event); at < f.Since || at > f.Until {
+		return false
+	}
+
+	kind := event.Type
+	if kind == "" {
+		kind = "container"
+	}
+	action := event.Action
+	if action == "" {
+		action = event.Status
+	}
+
+	return f.exact("type", kind) &&
+		f.exact("event", action) &&
+		f.fuzzy("container", event.Actor.ID, event.Actor.Attributes["name"]) &&
+		f.fuzzy("network", event.Actor.ID, event.Actor.Attributes["name"]) &&
+		f.fuzzy("volume", event.Actor.ID, event.Actor.Attributes["name"]) &&
+		f.image(event, kind) &&
+		f.labels(event.Actor.Attributes)
+}
+
+// Matches if no values are given for the key or one equals the source
+func (f *Filter) exact(key, source string) bool {
+	values, ok := f.Filters[key]
+	if !ok {
+		return true
+	}
+
+	for _, value := range values {
+		if value == source {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches if no values are given for the key or one equals or is a prefix
+// of the ID, or equals the name
+func (f *Filter) fuzzy(key, id, name string) bool {
+	values, ok := f.Filters[key]
+	if !ok {
+		return true
+	}
+
+	for _, value := range values {
+		if value == name || strings.HasPrefix(id, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches the event's image, with or without tag
+func (f *Filter) image(event *docker.APIEvents, kind string) bool {
+	values, ok := f.Filters["image"]
+	if !ok {
+		return true
+	}
+
+	image := event.Actor.Attributes["image"]
+	if kind == "image" {
+		image = event.Actor.ID
+	} else if image == "" {
+		image = event.From
+	}
+
+	for _, value := range values {
+		if value == image || value == untagged(image) {
+			return true
+		}
+	}
+	return false
+}
+
+// Matches "key" or "key=value" against the given attributes
+func (f *Filter) labels(attributes map[string]string) bool {
+	for _, value := range f.Filters["label"] {
+		pair := strings.SplitN(value, "=", 2)
+		actual, ok := attributes[pair[0]]
+		if !ok || (len(pair) == 2 && actual != pair[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Strips the tag from an image name, leaving registry ports intact
+func untagged(image string) string {
+	if pos := strings.LastIndex(image, ":"); pos > strings.LastIndex(image, "/") {
+		return image[0:pos]
+	}
+	return image
+}
@@ -0,0 +1,54 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+type History struct {
+	lock   sync.Mutex
+	events []*docker.APIEvents
+	next   int
+	full   bool
+}
+
+// Remember returns a history keeping the given number of most recently
+// emitted events
+func Remember(size int) *History {
+	return &History{events: make([]*docker.APIEvents, size)}
+}
+
+// Add adds an event, overwriting the oldest one if the history is full
+func (h *History) Add(event *docker.APIEvents) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	if len(h.events) == 0 {
+		return
+	}
+
+	h.events[h.next] = event
+	h.next = (h.next + 1) % len(h.events)
+	h.full = h.full || h.next == 0
+}
+
+// Matching returns all remembered events matching the given filter, in
+// the order they were emitted
+func (h *History) Matching(filter *Filter) []*docker.APIEvents {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	ordered := h.events[0:h.next]
+	if h.full {
+		ordered = append(append([]*docker.APIEvents{}, h.events[h.next:]...), h.events[0:h.next]...)
+	}
+
+	matching := make([]*docker.APIEvents, 0)
+	for _, event := range ordered {
+		if filter.Match(event) {
+			matching = append(matching, event)
+		}
+	}
+	return matching
+}
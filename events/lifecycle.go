@@ -0,0 +1,99 @@
+package events
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+type Booting struct {
+	Event *docker.APIEvents
+	Then  func() Action
+}
+
+type Announce struct {
+	Event  *docker.APIEvents
+	Action string
+	Then   func() Action
+}
+
+type Ready struct {
+	Event    *docker.APIEvents
+	Attempts int
+	ExitCode int
+	Duration time.Duration
+}
+
+type Failed struct {
+	Event    *docker.APIEvents
+	Attempts int
+	ExitCode int
+	Duration time.Duration
+	Reason   string
+	Then     Action
+}
+
+// Lifecycle returns a boot lifecycle event such as "boot:ready" for the
+// container the given event refers to, adding the given attributes to
+// the original ones
+func Lifecycle(event *docker.APIEvents, action string, attributes map[string]string) *docker.APIEvents {
+	now := time.Now()
+	merged := make(map[string]string)
+	for name, value := range event.Actor.Attributes {
+		merged[name] = value
+	}
+	for name, value := range attributes {
+		merged[name] = value
+	}
+
+	return &docker.APIEvents{
+		Type:     "container",
+		Action:   action,
+		ID:       event.Actor.ID,
+		From:     event.From,
+		Status:   action,
+		Actor:    docker.APIActor{ID: event.Actor.ID, Attributes: merged},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}
+}
+
+// Do emits a "boot:start" event, then performs the action returned by Then
+func (b *Booting) Do(events *Events) {
+	events.Emit(Lifecycle(b.Event, "boot:start", nil))
+	b.Then().Do(events)
+}
+
+// Do emits a lifecycle event with the given action, e.g. "boot:drain",
+// then performs the action returned by Then
+func (a *Announce) Do(events *Events) {
+	events.Emit(Lifecycle(a.Event, a.Action, nil))
+	a.Then().Do(events)
+}
+
+// Do emits the event, followed by a "boot:ready" event
+func (r *Ready) Do(events *Events) {
+	events.Emit(r.Event)
+	events.Emit(Lifecycle(r.Event, "boot:ready", map[string]string{
+		"exitCode": strconv.Itoa(r.ExitCode),
+		"duration": r.Duration.String(),
+		"attempts": strconv.Itoa(r.Attempts),
+	}))
+}
+
+// Do emits a "boot:failed" event so clients can tell failed containers
+// from those never started. Then performs the action given by Then, if
+// any, e.g. stopping the container or emitting the event anyway.
+func (f *Failed) Do(events *Events) {
+	events.Emit(Lifecycle(f.Event, "boot:failed", map[string]string{
+		"exitCode": strconv.Itoa(f.ExitCode),
+		"duration": f.Duration.String(),
+		"attempts": strconv.Itoa(f.Attempts),
+		"reason":   f.Reason,
+	}))
+
+	if f.Then != nil {
+		f.Then.Do(events)
+	}
+}
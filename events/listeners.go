@@ -0,0 +1,136 @@
+package events
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/fsouza/go-dockerclient"
+	"github.com/tueftler/boot/output"
+)
+
+// Policies for when a subscription's queue is full
+const (
+	DROP       = "drop"
+	DISCONNECT = "disconnect"
+	BLOCK      = "block"
+)
+
+type Subscription struct {
+	ID      int
+	Events  chan *docker.APIEvents
+	Done    chan bool
+	dropped int64
+	once    sync.Once
+}
+
+type Listeners struct {
+	Size          int
+	Policy        string
+	Log           *output.Stream
+	lock          sync.RWMutex
+	subscriptions map[*Subscription]bool
+	next          int
+}
+
+// Register returns an empty, synchronized registry of listeners, each
+// queueing up to the given number of events. If a queue is full, the
+// policy decides whether to drop the oldest event, disconnect the
+// listener or block until there is room again.
+func Register(size int, policy string, log *output.Stream) *Listeners {
+	return &Listeners{Size: size, Policy: policy, Log: log, subscriptions: make(map[*Subscription]bool)}
+}
+
+// Dropped returns the number of events dropped for this subscription
+func (s *Subscription) Dropped() int64 {
+	return atomic.LoadInt64(&s.dropped)
+}
+
+// Closes this subscription's done channel, at most once
+func (s *Subscription) close() {
+	s.once.Do(func() {
+		close(s.Done)
+	})
+}
+
+// Subscribe adds a new subscription, which will receive all events sent
+// from now on until it is unsubscribed or disconnected, the latter being
+// signalled by closing its done channel
+func (l *Listeners) Subscribe() *Subscription {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.next++
+	subscription := &Subscription{ID: l.next, Events: make(chan *docker.APIEvents, l.Size), Done: make(chan bool)}
+	l.subscriptions[subscription] = true
+	return subscription
+}
+
+// Unsubscribe removes a given subscription. Sends currently blocked on it
+// are cancelled, so it's safe to call this without receiving its events.
+func (l *Listeners) Unsubscribe(subscription *Subscription) {
+	subscription.close()
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	delete(l.subscriptions, subscription)
+}
+
+// Count returns the number of subscriptions
+func (l *Listeners) Count() int {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return len(l.subscriptions)
+}
+
+// Send queues an event for all subscriptions, returning their number
+func (l *Listeners) Send(event *docker.APIEvents) int {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	for subscription := range l.subscriptions {
+		switch l.Policy {
+		case BLOCK:
+			select {
+			case subscription.Events <- event:
+			case <-subscription.Done:
+			}
+
+		case DISCONNECT:
+			select {
+			case subscription.Events <- event:
+			case <-subscription.Done:
+			default:
+				dropped := atomic.AddInt64(&subscription.dropped, 1)
+				l.Log.Warning("Queue for listener #%d full, dropped %s event (%d so far) and disconnecting", subscription.ID, event.Action, dropped)
+				subscription.close()
+			}
+
+		default:
+			l.drop(subscription, event)
+		}
+	}
+	return len(l.subscriptions)
+}
+
+// Queues an event, dropping the oldest ones queued until there is room
+func (l *Listeners) drop(subscription *Subscription, event *docker.APIEvents) {
+	for {
+		select {
+		case subscription.Events <- event:
+			return
+
+		case <-subscription.Done:
+			return
+
+		default:
+			select {
+			case oldest := <-subscription.Events:
+				dropped := atomic.AddInt64(&subscription.dropped, 1)
+				l.Log.Warning("Queue for listener #%d full, dropped %s event (%d so far)", subscription.ID, oldest.Action, dropped)
+			default:
+			}
+		}
+	}
+}
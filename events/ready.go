@@ -0,0 +1,202 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+type waiter struct {
+	names   []string
+	depends [][]string
+	cancel  context.CancelFunc
+}
+
+type Readiness struct {
+	lock    sync.Mutex
+	ready   map[string][]string
+	waiting map[string]waiter
+	changed chan bool
+}
+
+// Track returns a readiness instance keeping track of which containers
+// have been announced as started
+func Track() *Readiness {
+	return &Readiness{
+		ready:   make(map[string][]string),
+		waiting: make(map[string]waiter),
+		changed: make(chan bool),
+	}
+}
+
+// Names returns the names a container can be referred to by: its ID,
+// its name and - if started by Docker Compose - its service name, scoped
+// by its project, e.g. "app_db"
+func Names(event *docker.APIEvents) []string {
+	names := []string{event.Actor.ID}
+	if name, ok := event.Actor.Attributes["name"]; ok {
+		names = append(names, strings.TrimPrefix(name, "/"))
+	}
+	if service, ok := event.Actor.Attributes["com.docker.compose.service"]; ok {
+		names = append(names, scope(event, service))
+	}
+	return names
+}
+
+// Scopes a service name by the Compose project of the given event's
+// container, if any
+func scope(event *docker.APIEvents, service string) string {
+	if project, ok := event.Actor.Attributes["com.docker.compose.project"]; ok {
+		return project + "_" + service
+	}
+	return service
+}
+
+// Returns the names a dependency may refer to: the name itself, and a
+// service within the same Compose project as the given event's container
+func aliases(event *docker.APIEvents, depend string) []string {
+	if scoped := scope(event, depend); scoped != depend {
+		return []string{depend, scoped}
+	}
+	return []string{depend}
+}
+
+// Update marks the container as ready when its start event is emitted,
+// and as not ready anymore once it dies, waking up anyone waiting
+func (r *Readiness) Update(event *docker.APIEvents) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	switch event.Action {
+	case "start":
+		r.ready[event.Actor.ID] = Names(event)
+
+	case "die", "destroy":
+		delete(r.ready, event.Actor.ID)
+
+	default:
+		return
+	}
+
+	close(r.changed)
+	r.changed = make(chan bool)
+}
+
+// Ready returns whether a container is ready, referring to it by any of
+// its names
+func (r *Readiness) Ready(name string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.lookup(name)
+}
+
+// Wait waits until all containers the one the given event refers to
+// depends on are ready, or the context is done. Compose service names
+// refer to services in the same project. Returns an error if waiting
+// would create a dependency cycle.
+func (r *Readiness) Wait(ctx context.Context, event *docker.APIEvents, depends []string) error {
+	resolved := make([][]string, len(depends))
+	for i, depend := range depends {
+		resolved[i] = aliases(event, depend)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	r.lock.Lock()
+	names := Names(event)
+	if cycle := r.cycle(names, resolved, []string{names[0]}); cycle != nil {
+		r.lock.Unlock()
+		return fmt.Errorf("Dependency cycle %s", strings.Join(cycle, " -> "))
+	}
+	r.waiting[event.Actor.ID] = waiter{names: names, depends: resolved, cancel: cancel}
+	r.lock.Unlock()
+
+	defer func() {
+		r.lock.Lock()
+		delete(r.waiting, event.Actor.ID)
+		r.lock.Unlock()
+	}()
+
+	for {
+		r.lock.Lock()
+		pending := make([]string, 0)
+		for _, alternatives := range resolved {
+			if !r.lookup(alternatives...) {
+				pending = append(pending, alternatives[0])
+			}
+		}
+		changed := r.changed
+		r.lock.Unlock()
+
+		if len(pending) == 0 {
+			return nil
+		}
+
+		select {
+		case <-changed:
+			continue
+
+		case <-ctx.Done():
+			return fmt.Errorf("Waiting for %s: %s", strings.Join(pending, ", "), ctx.Err().Error())
+		}
+	}
+}
+
+// Cancel stops the given container from waiting, if it is, e.g. because
+// it died meanwhile
+func (r *Readiness) Cancel(id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if waiter, ok := r.waiting[id]; ok {
+		waiter.cancel()
+	}
+}
+
+// Looks up a ready container by any of its names, matching any of the
+// given ones
+func (r *Readiness) lookup(search ...string) bool {
+	for _, names := range r.ready {
+		if matches(names, search) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns whether any of the given names is among the candidates
+func matches(candidates, names []string) bool {
+	for _, candidate := range candidates {
+		for _, name := range names {
+			if candidate == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Follows dependencies of waiting containers, returning the path if one
+// of the given names is reached again
+func (r *Readiness) cycle(names []string, depends [][]string, path []string) []string {
+	for _, alternatives := range depends {
+		if matches(names, alternatives) {
+			return append(path, alternatives[0])
+		}
+
+		for _, waiter := range r.waiting {
+			if matches(waiter.names, alternatives) {
+				if found := r.cycle(names, waiter.depends, append(path, alternatives[0])); found != nil {
+					return found
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
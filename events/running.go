@@ -0,0 +1,61 @@
+package events
+
+import (
+	"strings"
+	"time"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+// Synthesize creates a start event for a container listed by the Docker API
+// the way the Docker daemon would when it is started
+func Synthesize(container docker.APIContainers, now time.Time) *docker.APIEvents {
+	attributes := map[string]string{"image": container.Image}
+	for name, value := range container.Labels {
+		attributes[name] = value
+	}
+	if len(container.Names) > 0 {
+		attributes["name"] = strings.TrimPrefix(container.Names[0], "/")
+	}
+
+	return &docker.APIEvents{
+		Status:   "start",
+		ID:       container.ID,
+		From:     container.Image,
+		Type:     "container",
+		Action:   "start",
+		Actor:    docker.APIActor{ID: container.ID, Attributes: attributes},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}
+}
+
+// Running lists containers already running, e.g. because they were started
+// while Boot was not, and passes synthesized start events for them to
+// Handle() - not waiting for it to return. Containers whose start event
+// is already being handled or which are known otherwise are skipped, as
+// will be start events received later on which happened before listing.
+func (e *Events) Running(known func(id string) bool) error {
+	containers, err := e.Client.ListContainers(docker.ListContainersOptions{})
+	if err != nil {
+		return err
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	now := time.Now()
+	e.Log.Info("Found %d running container(s)", len(containers))
+	for _, container := range containers {
+		if e.Sequence.Busy(container.ID) || known(container.ID) {
+			continue
+		}
+
+		event := Synthesize(container, now)
+		e.listed[container.ID] = event.TimeNano
+		if e.Sequence.Enter(event) {
+			go e.handle(event)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package events
+
+import (
+	"fmt"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+type Seen struct {
+	keys  map[string]bool
+	order []string
+	next  int
+}
+
+// Recall returns a set remembering the given number of most recently
+// received events, used to skip those replayed after reconnecting
+func Recall(size int) *Seen {
+	return &Seen{keys: make(map[string]bool), order: make([]string, size)}
+}
+
+// Add adds an event, forgetting the oldest one if the set is full. Returns
+// false if the event has already been seen.
+func (s *Seen) Add(event *docker.APIEvents) bool {
+	key := fmt.Sprintf("%d %s %s %s", event.TimeNano, event.Type, event.Action, event.Actor.ID)
+	if s.keys[key] {
+		return false
+	}
+
+	delete(s.keys, s.order[s.next])
+	s.order[s.next] = key
+	s.next = (s.next + 1) % len(s.order)
+	s.keys[key] = true
+	return true
+}
@@ -0,0 +1,62 @@
+package events
+
+import (
+	"sync"
+
+	"github.com/fsouza/go-dockerclient"
+)
+
+type Sequence struct {
+	lock   sync.Mutex
+	queues map[string][]*docker.APIEvents
+}
+
+// Serialize returns a sequence keeping events in order per container
+func Serialize() *Sequence {
+	return &Sequence{queues: make(map[string][]*docker.APIEvents)}
+}
+
+// Enter queues an event behind those for the same container still being
+// handled. Returns true if there are none and the event may be handled
+// right away, false if it will be returned by Leave() later on.
+func (s *Sequence) Enter(event *docker.APIEvents) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	queue, busy := s.queues[event.Actor.ID]
+	s.queues[event.Actor.ID] = append(queue, event)
+	return !busy
+}
+
+// Leave marks an event as handled and returns the next queued event for
+// the same container, or nil if there is none
+func (s *Sequence) Leave(event *docker.APIEvents) *docker.APIEvents {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	queue := s.queues[event.Actor.ID][1:]
+	if len(queue) == 0 {
+		delete(s.queues, event.Actor.ID)
+		return nil
+	}
+
+	s.queues[event.Actor.ID] = queue
+	return queue[0]
+}
+
+// Busy returns whether events for the given container are being handled
+func (s *Sequence) Busy(id string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	_, busy := s.queues[id]
+	return busy
+}
+
+// Pending returns the number of containers with events being handled
+func (s *Sequence) Pending() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.queues)
+}
@@ -1,5 +1,9 @@
 package output
 
+import "regexp"
+
+var escapes = regexp.MustCompile("\033\\[[0-9;]*m")
+
 var colors = map[string]string{
 	"error":     "31",
 	"success":   "32",
@@ -13,3 +17,8 @@ var colors = map[string]string{
 func Text(name, text string) string {
 	return "\033[" + colors[name] + "m" + text + "\033[0m"
 }
+
+// Plain returns the text with all colors removed
+func Plain(text string) string {
+	return escapes.ReplaceAllString(text, "")
+}
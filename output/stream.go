@@ -3,6 +3,7 @@ package output
 import (
 	"bytes"
 	"fmt"
+	"sync"
 )
 
 var Print = func(arg string) { fmt.Print(arg) }
@@ -10,7 +11,9 @@ var Print = func(arg string) { fmt.Print(arg) }
 type Stream struct {
 	Prefix  string
 	writer  func(string)
+	tee     func(string)
 	started bool
+	lock    sync.Mutex
 }
 
 // NewStream creates a stream with a given prefix and writer
@@ -21,7 +24,14 @@ func NewStream(prefix string, writer func(string)) *Stream {
 // Prefixed creates a stream on the same writer as this stream, but
 // with a different prefix
 func (s *Stream) Prefixed(prefix string) *Stream {
-	return &Stream{Prefix: prefix, writer: s.writer, started: false}
+	return &Stream{Prefix: prefix, writer: s.writer, tee: s.tee, started: false}
+}
+
+// Tee creates a stream on the same writer and with the same prefix as this
+// stream, which additionally passes everything written to it except for
+// the prefix on to the given writer
+func (s *Stream) Tee(writer func(string)) *Stream {
+	return &Stream{Prefix: s.Prefix, writer: s.writer, tee: writer, started: false}
 }
 
 // Printf formats arguments without any coloring
@@ -59,10 +69,20 @@ func (s *Stream) Success(format string, args ...interface{}) {
 	fmt.Fprintf(s, Text("success", format)+"\n", args...)
 }
 
-// Write writes the given bytes, prefixing all lines with the given prefix
+// Write writes the given bytes, prefixing all lines with the given prefix.
+// Safe to be called from multiple goroutines.
 func (s *Stream) Write(p []byte) (n int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.write(p)
+	return len(p), nil
+}
+
+// Writes bytes line by line
+func (s *Stream) write(p []byte) {
 	if len(p) == 0 {
-		return 0, nil
+		return
 	}
 
 	if !s.started {
@@ -72,13 +92,19 @@ func (s *Stream) Write(p []byte) (n int, err error) {
 
 	pos := bytes.IndexByte(p, '\n')
 	if pos == -1 {
-		s.writer(string(p))
+		s.emit(string(p))
 	} else {
 		pos++
-		s.writer(string(p[0:pos]))
+		s.emit(string(p[0:pos]))
 		s.started = false
-		s.Write(p[pos:])
+		s.write(p[pos:])
 	}
+}
 
-	return len(p), nil
+// Passes text on to the writer and, if present, the tee
+func (s *Stream) emit(text string) {
+	s.writer(text)
+	if s.tee != nil {
+		s.tee(text)
+	}
 }
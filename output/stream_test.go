@@ -134,3 +134,24 @@ func Test_success(t *testing.T) {
 
 	assertEqual("> "+Text("success", "Test")+"\n", written, t)
 }
+
+func Test_tee(t *testing.T) {
+	written, teed := "", ""
+	stream := NewStream("> ", func(arg string) { written += arg }).Tee(func(arg string) { teed += arg })
+	io.WriteString(stream, "Line 1\nLine 2\n")
+
+	assertEqual("> Line 1\n> Line 2\n", written, t)
+	assertEqual("Line 1\nLine 2\n", teed, t)
+}
+
+func Test_prefixed_keeps_tee(t *testing.T) {
+	teed := ""
+	stream := NewStream("> ", func(arg string) {}).Tee(func(arg string) { teed += arg }).Prefixed("!")
+	io.WriteString(stream, "Test\n")
+
+	assertEqual("Test\n", teed, t)
+}
+
+func Test_plain(t *testing.T) {
+	assertEqual("Test", Plain(Text("container", "Test")), t)
+}
@@ -0,0 +1,148 @@
+package policy
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/tueftler/boot/output"
+)
+
+// Requests allowed by the "read-only" preset, inspecting but never changing
+// containers, images, networks, volumes and services
+const READONLY = `
+GET  /_ping
+HEAD /_ping
+GET  /version
+GET  /info
+GET  /events
+GET  /containers/json
+GET  /containers/*/json
+GET  /containers/*/top
+GET  /containers/*/logs
+GET  /containers/*/stats
+GET  /containers/*/changes
+GET  /images/json
+GET  /images/*/json
+GET  /images/*/history
+GET  /networks
+GET  /networks/*
+GET  /volumes
+GET  /volumes/*
+GET  /services
+GET  /services/*
+GET  /tasks
+GET  /tasks/*
+GET  /nodes
+GET  /nodes/*
+GET  /_boot/containers
+`
+
+// API version prefixes such as "/v1.41", which are not part of patterns
+var version = regexp.MustCompile(`^/v[0-9.]+/`)
+
+type Rule struct {
+	Method  string
+	Pattern string
+	path    *regexp.Regexp
+}
+
+type Policy struct {
+	Rules []Rule
+	Next  http.Handler
+	Log   *output.Stream
+}
+
+// Allow returns a policy passing requests matching any of the given rules
+// on to the next handler, and denying all others
+func Allow(rules []Rule, next http.Handler, log *output.Stream) *Policy {
+	return &Policy{Rules: rules, Next: next, Log: log}
+}
+
+// Named returns the rules of a named preset, "read-only", or otherwise
+// loads them from the file with the given name
+func Named(name string) ([]Rule, error) {
+	if name == "read-only" {
+		return Parse(strings.NewReader(READONLY))
+	}
+
+	file, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Parse(file)
+}
+
+// Parse parses rules, one per line consisting of a method and a path
+// pattern, e.g. "GET /containers/*". The method may be "*" to match
+// any method, and "*" in patterns matches anything including slashes.
+// Empty lines and lines starting with "#" are ignored.
+func Parse(input io.Reader) ([]Rule, error) {
+	rules := make([]Rule, 0)
+	scanner := bufio.NewScanner(input)
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Line %d: expected method and pattern, have '%s'", number, line)
+		} else if !strings.HasPrefix(fields[1], "/") {
+			return nil, fmt.Errorf("Line %d: pattern '%s' must start with /", number, fields[1])
+		}
+
+		rules = append(rules, Compile(fields[0], fields[1]))
+	}
+	return rules, scanner.Err()
+}
+
+// Compile returns a rule for a given method and path pattern
+func Compile(method, pattern string) Rule {
+	expression := strings.Replace(regexp.QuoteMeta(pattern), `\*`, `.*`, -1)
+	return Rule{Method: strings.ToUpper(method), Pattern: pattern, path: regexp.MustCompile("^" + expression + "$")}
+}
+
+// Matches returns whether a given method and path match this rule
+func (r Rule) Matches(method, target string) bool {
+	return (r.Method == "*" || r.Method == method) && r.path.MatchString(target)
+}
+
+// Allows returns whether a request is allowed, ignoring API versions.
+// Paths which are not in their canonical form, e.g. containing "..",
+// are never allowed.
+func (p *Policy) Allows(r *http.Request) bool {
+	if path.Clean(r.URL.Path) != r.URL.Path {
+		return false
+	}
+
+	target := version.ReplaceAllString(r.URL.Path, "/")
+	for _, rule := range p.Rules {
+		if rule.Matches(r.Method, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHTTP is the http.Handler implementation
+func (p *Policy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.Allows(r) {
+		p.Next.ServeHTTP(w, r)
+		return
+	}
+
+	p.Log.Warning("Denied %s %s from %s", r.Method, r.URL, r.RemoteAddr)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusForbidden)
+	json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("Access denied by policy: %s %s", r.Method, r.URL.Path)})
+}
@@ -0,0 +1,107 @@
+package policy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tueftler/boot/output"
+)
+
+func assertEqual(expect, actual interface{}, t *testing.T) {
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
+	}
+}
+
+// Returns a policy with the given rules in front of a handler answering "OK"
+func allowing(rules string, log *output.Stream) *Policy {
+	parsed, err := Parse(strings.NewReader(rules))
+	if err != nil {
+		panic(err)
+	}
+
+	return Allow(parsed, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}), log)
+}
+
+func serve(fixture *Policy, method, target string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	fixture.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+func Test_parse(t *testing.T) {
+	rules, err := Parse(strings.NewReader("# Traefik\nGET /containers/*\n\n* /events\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertEqual(2, len(rules), t)
+	assertEqual("GET", rules[0].Method, t)
+	assertEqual("/containers/*", rules[0].Pattern, t)
+	assertEqual("*", rules[1].Method, t)
+}
+
+func Test_parse_errors(t *testing.T) {
+	_, err := Parse(strings.NewReader("GET /info\nGET\n"))
+	assertEqual("Line 2: expected method and pattern, have 'GET'", err.Error(), t)
+
+	_, err = Parse(strings.NewReader("GET info"))
+	assertEqual("Line 1: pattern 'info' must start with /", err.Error(), t)
+}
+
+func Test_matches(t *testing.T) {
+	rule := Compile("get", "/containers/*/json")
+
+	assertEqual(true, rule.Matches("GET", "/containers/web/json"), t)
+	assertEqual(false, rule.Matches("POST", "/containers/web/json"), t)
+	assertEqual(false, rule.Matches("GET", "/containers/web/logs"), t)
+}
+
+func Test_allows(t *testing.T) {
+	fixture := allowing("GET /containers/*\n", output.NewStream("", func(arg string) {}))
+	response := serve(fixture, "GET", "/v1.41/containers/json")
+
+	assertEqual(http.StatusOK, response.Code, t)
+	assertEqual("OK", response.Body.String(), t)
+}
+
+func Test_denies(t *testing.T) {
+	written := ""
+	fixture := allowing("GET /containers/*\n", output.NewStream("> ", func(arg string) { written += arg }))
+	response := serve(fixture, "POST", "/containers/web/kill")
+
+	assertEqual(http.StatusForbidden, response.Code, t)
+	assertEqual("application/json", response.Header().Get("Content-Type"), t)
+	assertEqual(`{"message":"Access denied by policy: POST /containers/web/kill"}`+"\n", response.Body.String(), t)
+	assertEqual("> "+output.Text("warning", "Denied POST /containers/web/kill from 192.0.2.1:1234")+"\n", written, t)
+}
+
+func Test_denies_non_canonical_paths(t *testing.T) {
+	fixture := allowing("GET /containers/*\n", output.NewStream("", func(arg string) {}))
+
+	assertEqual(http.StatusForbidden, serve(fixture, "GET", "/containers/../images/web/get").Code, t)
+}
+
+func Test_read_only(t *testing.T) {
+	rules, err := Named("read-only")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixture := Allow(rules, http.NotFoundHandler(), output.NewStream("", func(arg string) {}))
+
+	assertEqual(http.StatusNotFound, serve(fixture, "GET", "/v1.24/containers/web/json").Code, t)
+	assertEqual(http.StatusNotFound, serve(fixture, "GET", "/events").Code, t)
+	assertEqual(http.StatusForbidden, serve(fixture, "POST", "/containers/create").Code, t)
+	assertEqual(http.StatusForbidden, serve(fixture, "GET", "/containers/web/export").Code, t)
+	assertEqual(http.StatusForbidden, serve(fixture, "DELETE", "/containers/web").Code, t)
+}
+
+func Test_named_file(t *testing.T) {
+	_, err := Named("/does/not/exist")
+	assertEqual(true, err != nil, t)
+}
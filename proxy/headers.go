@@ -0,0 +1,88 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Hop-by-hop headers as per RFC 7230, which apply to a single connection
+// and must not be forwarded
+var hopByHop = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Returns the comma-separated tokens of a header, e.g. "Connection"
+func tokens(header http.Header, name string) []string {
+	tokens := make([]string, 0)
+	for _, value := range header[http.CanonicalHeaderKey(name)] {
+		for _, token := range strings.Split(value, ",") {
+			if token = strings.TrimSpace(token); token != "" {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// Returns whether a header contains a given token, ignoring case
+func contains(header http.Header, name, token string) bool {
+	for _, candidate := range tokens(header, name) {
+		if strings.EqualFold(candidate, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a copy of the given headers without hop-by-hop headers, neither
+// the well-known ones nor those listed in "Connection"
+func endToEnd(header http.Header) http.Header {
+	result := make(http.Header, len(header))
+	for name, values := range header {
+		result[name] = append([]string(nil), values...)
+	}
+
+	for _, name := range tokens(header, "Connection") {
+		result.Del(name)
+	}
+	for _, name := range hopByHop {
+		result.Del(name)
+	}
+	return result
+}
+
+// Returns the headers to forward a request with, adding this proxy to
+// "Via" and the client's address to "X-Forwarded-For". Clients on unix
+// sockets have no address.
+func forwarding(r *http.Request) http.Header {
+	header := endToEnd(r.Header)
+	header.Add("Via", "1.1 Boot")
+
+	if client, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if prior := strings.Join(r.Header["X-Forwarded-For"], ", "); prior != "" {
+			client = prior + ", " + client
+		}
+		header.Set("X-Forwarded-For", client)
+	}
+	return header
+}
+
+// Keeps a connection upgrade when forwarding headers, re-adding the hop
+// by hop headers it consists of
+func upgrade(from, to http.Header) {
+	if contains(from, "Connection", "upgrade") {
+		to.Set("Connection", "Upgrade")
+		if protocol := from.Get("Upgrade"); protocol != "" {
+			to.Set("Upgrade", protocol)
+		}
+	}
+}
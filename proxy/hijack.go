@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+)
+
+// Attaching to containers and starting exec instances hijack connections
+// even if the client does not ask for an upgrade
+var attaching = regexp.MustCompile(`^(/v[0-9.]+)?/(containers/[^/]+/attach|exec/[^/]+/start)$`)
+
+// Returns whether a request may cause the connection to be hijacked
+func hijacking(r *http.Request) bool {
+	return contains(r.Header, "Connection", "upgrade") || (r.Method == "POST" && attaching.MatchString(r.URL.Path))
+}
+
+// Returns whether a response switches to raw streams in both directions
+func switched(response *http.Response) bool {
+	if response.StatusCode == http.StatusSwitchingProtocols {
+		return true
+	}
+
+	kind := response.Header.Get("Content-Type")
+	return response.StatusCode == http.StatusOK && (kind == "application/vnd.docker.raw-stream" || kind == "application/vnd.docker.multiplexed-stream")
+}
+
+// Forwards a request over a connection of its own. If the response switches
+// protocols, hijacks the client's connection and splices both, otherwise
+// relays the response as usual.
+func (p *Proxy) hijack(w http.ResponseWriter, r *http.Request) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		p.fail(w, fmt.Errorf("Cannot hijack %T", w))
+		return
+	}
+
+	upstream, err := p.Address.Dial()
+	if err != nil {
+		p.fail(w, err)
+		return
+	}
+	defer upstream.Close()
+
+	forward := r.WithContext(r.Context())
+	forward.Header = forwarding(r)
+	upgrade(r.Header, forward.Header)
+
+	// It doesn't matter what these are set to, but they need to be set
+	forward.URL.Scheme = "http"
+	forward.URL.Host = "unix.sock"
+
+	if err := forward.Write(upstream); err != nil {
+		p.fail(w, err)
+		return
+	}
+
+	output := bufio.NewReader(upstream)
+	response, err := http.ReadResponse(output, forward)
+	if err != nil {
+		p.fail(w, err)
+		return
+	}
+	defer response.Body.Close()
+
+	if !switched(response) {
+		p.relay(w, response)
+		return
+	}
+
+	client, buffered, err := hijacker.Hijack()
+	if err != nil {
+		p.fail(w, err)
+		return
+	}
+	defer client.Close()
+
+	p.Log.Println("<<< ", response.Status, " (hijacked)")
+	header := endToEnd(response.Header)
+	upgrade(response.Header, header)
+	header.Add("Via", "1.1 Boot")
+	fmt.Fprintf(buffered, "HTTP/%d.%d %s\r\n", response.ProtoMajor, response.ProtoMinor, response.Status)
+	header.Write(buffered)
+	buffered.WriteString("\r\n")
+	if err := buffered.Flush(); err != nil {
+		return
+	}
+
+	splice(client, buffered.Reader, upstream, output)
+}
+
+// Copies data between client and upstream in both directions. Once the
+// client is done sending, only closes the upstream connection for writing
+// so its output can still be received; returns once the output ends.
+func splice(client net.Conn, input io.Reader, upstream net.Conn, output io.Reader) {
+	go func() {
+		io.Copy(upstream, input)
+		closeWrite(upstream)
+	}()
+
+	io.Copy(client, output)
+	closeWrite(client)
+}
+
+// Closes a connection for writing, if supported
+func closeWrite(conn net.Conn) {
+	if c, ok := conn.(interface {
+		CloseWrite() error
+	}); ok {
+		c.CloseWrite()
+	}
+}
@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+)
+
+var listing = regexp.MustCompile(`^(/v[0-9.]+)?/containers/json$`)
+var inspecting = regexp.MustCompile(`^(/v[0-9.]+)?/containers/[^/]+/json$`)
+
+type Listing struct {
+	Ready    func(id string) bool
+	Annotate func(id string) (interface{}, bool)
+}
+
+// Filter returns a rewrite for container listings, leaving out containers
+// which are not ready, and adding a "Boot" field to inspected containers
+// with the annotation for it, if any
+func Filter(ready func(id string) bool, annotate func(id string) (interface{}, bool)) *Listing {
+	return &Listing{Ready: ready, Annotate: annotate}
+}
+
+// Rewrite rewrites the response to successful GET requests listing or
+// inspecting containers, leaving all others untouched. If the response
+// cannot be rewritten, its body is restored and the error returned.
+func (l *Listing) Rewrite(r *http.Request, response *http.Response) error {
+	if r.Method != "GET" || response.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	var rewrite func(body []byte) ([]byte, error)
+	switch {
+	case listing.MatchString(r.URL.Path):
+		rewrite = l.list
+	case inspecting.MatchString(r.URL.Path):
+		rewrite = l.inspect
+	default:
+		return nil
+	}
+
+	body, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	rewritten, err := rewrite(body)
+	if err != nil {
+		rewritten = body
+	}
+
+	response.Body = ioutil.NopCloser(bytes.NewReader(rewritten))
+	response.ContentLength = int64(len(rewritten))
+	return err
+}
+
+// Leaves out running containers which are not ready. Containers which are
+// not running, e.g. listed when passing "all", are kept.
+func (l *Listing) list(body []byte) ([]byte, error) {
+	var containers []map[string]json.RawMessage
+	if err := json.Unmarshal(body, &containers); err != nil {
+		return nil, err
+	}
+
+	ready := make([]map[string]json.RawMessage, 0, len(containers))
+	for _, container := range containers {
+		var id string
+		if err := json.Unmarshal(container["Id"], &id); err != nil {
+			return nil, err
+		}
+
+		var state string
+		if raw, ok := container["State"]; ok {
+			json.Unmarshal(raw, &state)
+		}
+
+		if (state != "" && state != "running") || l.Ready(id) {
+			ready = append(ready, container)
+		}
+	}
+	return json.Marshal(ready)
+}
+
+// Adds the annotation for an inspected container
+func (l *Listing) inspect(body []byte) ([]byte, error) {
+	var container map[string]json.RawMessage
+	if err := json.Unmarshal(body, &container); err != nil {
+		return nil, err
+	}
+
+	var id string
+	if err := json.Unmarshal(container["Id"], &id); err != nil {
+		return nil, err
+	}
+
+	annotation, ok := l.Annotate(id)
+	if !ok {
+		return body, nil
+	}
+
+	encoded, err := json.Marshal(annotation)
+	if err != nil {
+		return nil, err
+	}
+
+	container["Boot"] = encoded
+	return json.Marshal(container)
+}
@@ -1,17 +1,21 @@
 package proxy
 
 import (
-	"fmt"
+	"context"
+	"encoding/json"
 	"io"
 	"net"
 	"net/http"
+	"strconv"
 
 	"github.com/tueftler/boot/addr"
 	"github.com/tueftler/boot/output"
 )
 
 type Proxy struct {
+	Address addr.Addr
 	Forward *http.Client
+	Rewrite func(r *http.Request, response *http.Response) error
 	Log     *output.Stream
 }
 
@@ -20,35 +24,102 @@ func Pass(address addr.Addr, log *output.Stream) *Proxy {
 	transport := &http.Transport{Dial: func(network, addr string) (net.Conn, error) {
 		return address.Dial()
 	}}
-	return &Proxy{Forward: &http.Client{Transport: transport}, Log: log}
+	return &Proxy{Address: address, Forward: &http.Client{Transport: transport}, Log: log}
 }
 
-// ServeHTTP is the http.Handler implementation
+// ServeHTTP is the http.Handler implementation. Streams responses, e.g.
+// from "docker logs -f", flushing data as it arrives, and cancels the
+// forwarded request once the client disconnects. Requests for attaching
+// to containers or upgrading the connection are hijacked. Responses may be
+// rewritten before being relayed, see Rewrite.
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	p.Log.Println(">>> ", r.Method, r.URL)
 
-	r.RequestURI = ""
+	if hijacking(r) {
+		p.hijack(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	forward := r.WithContext(ctx)
+	forward.RequestURI = ""
+	forward.Header = forwarding(r)
 
 	// It doesn't matter what these are set to, but they need to be set
-	r.URL.Scheme = "http"
-	r.URL.Host = "unix.sock"
+	forward.URL.Scheme = "http"
+	forward.URL.Host = "unix.sock"
 
-	response, err := p.Forward.Do(r)
+	response, err := p.Forward.Do(forward)
 	if err != nil {
-		p.Log.Println("<<< 502 ", err.Error())
-		w.WriteHeader(502)
-		fmt.Fprintf(w, "<h1>Proxy error</h1><pre>%s</pre>", err.Error())
+		p.fail(w, err)
 		return
 	}
+	defer response.Body.Close()
+
+	if p.Rewrite != nil {
+		if err := p.Rewrite(r, response); err != nil {
+			p.Log.Println("<<< Rewrite error ", err.Error())
+		}
+	}
+
+	p.relay(w, response)
+}
+
+// Answers with a proxy error, formatted as JSON like Docker's errors
+func (p *Proxy) fail(w http.ResponseWriter, err error) {
+	p.Log.Println("<<< 502 ", err.Error())
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadGateway)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Proxy error: " + err.Error()})
+}
 
+// Relays a response's end-to-end headers and body to the client
+func (p *Proxy) relay(w http.ResponseWriter, response *http.Response) {
 	p.Log.Println("<<< ", response.Status)
-	for header, values := range response.Header {
+	for header, values := range endToEnd(response.Header) {
 		for _, value := range values {
 			w.Header().Add(header, value)
 		}
 	}
 
+	// Chunked responses have no length, and are chunked again when flushed
+	if response.ContentLength >= 0 {
+		w.Header().Set("Content-Length", strconv.FormatInt(response.ContentLength, 10))
+	}
+
 	w.Header().Add("Via", "1.1 Boot")
 	w.WriteHeader(response.StatusCode)
-	io.Copy(w, response.Body)
+	if err := stream(w, response.Body); err != nil && response.Request.Context().Err() == nil {
+		p.Log.Println("<<< Aborted ", err.Error())
+	}
+}
+
+// Copies a response body, flushing after each read so clients receive
+// data as soon as it arrives
+func stream(w http.ResponseWriter, body io.Reader) error {
+	flusher, ok := w.(http.Flusher)
+	if ok {
+		flusher.Flush()
+	}
+
+	buffer := make([]byte, 32*1024)
+	for {
+		n, err := body.Read(buffer)
+		if n > 0 {
+			if _, err := w.Write(buffer[0:n]); err != nil {
+				return err
+			}
+			if ok {
+				flusher.Flush()
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
 }
@@ -0,0 +1,326 @@
+package proxy
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/tueftler/boot/addr"
+	"github.com/tueftler/boot/output"
+)
+
+func assertEqual(expect, actual interface{}, t *testing.T) {
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
+	}
+}
+
+// Starts a proxy in front of a fake Docker daemon using the given handler,
+// returning its URL and a function to stop both
+func passing(t *testing.T, handler http.HandlerFunc) (string, func()) {
+	daemon := httptest.NewServer(handler)
+	address, err := addr.Parse(daemon.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(Pass(address, output.NewStream("", func(arg string) {})))
+	return server.URL, func() {
+		server.Close()
+		daemon.Close()
+	}
+}
+
+func Test_pass(t *testing.T) {
+	url, stop := passing(t, func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", r.Method, r.URL.Path)
+	})
+	defer stop()
+
+	response, err := http.Get(url + "/containers/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, _ := ioutil.ReadAll(response.Body)
+	assertEqual("GET /containers/json", string(body), t)
+	assertEqual("1.1 Boot", response.Header.Get("Via"), t)
+}
+
+func Test_content_length(t *testing.T) {
+	url, stop := passing(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "2")
+		w.Write([]byte("OK"))
+	})
+	defer stop()
+
+	response, err := http.Get(url + "/_ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	assertEqual(int64(2), response.ContentLength, t)
+	assertEqual([]string(nil), response.TransferEncoding, t)
+}
+
+func Test_streams_incrementally(t *testing.T) {
+	release := make(chan bool)
+	url, stop := passing(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("first\n"))
+		w.(http.Flusher).Flush()
+		<-release
+		w.Write([]byte("second\n"))
+	})
+	defer stop()
+
+	response, err := http.Get(url + "/containers/web/logs?follow=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	first := make([]byte, 6)
+	if _, err := io.ReadFull(response.Body, first); err != nil {
+		t.Fatal(err)
+	}
+	assertEqual("first\n", string(first), t)
+	assertEqual([]string{"chunked"}, response.TransferEncoding, t)
+
+	close(release)
+	rest, _ := ioutil.ReadAll(response.Body)
+	assertEqual("second\n", string(rest), t)
+}
+
+func Test_cancels_on_disconnect(t *testing.T) {
+	canceled := make(chan bool, 1)
+	url, stop := passing(t, func(w http.ResponseWriter, r *http.Request) {
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+		canceled <- true
+	})
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	request, _ := http.NewRequest("GET", url+"/containers/web/stats", nil)
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	cancel()
+	assertEqual(true, <-canceled, t)
+}
+
+func Test_bad_gateway(t *testing.T) {
+	server := httptest.NewServer(Pass(&addr.UnixSocket{Path: "/does/not/exist.sock"}, output.NewStream("", func(arg string) {})))
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/_ping")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	var failure struct{ Message string }
+	json.NewDecoder(response.Body).Decode(&failure)
+	assertEqual(http.StatusBadGateway, response.StatusCode, t)
+	assertEqual("application/json", response.Header.Get("Content-Type"), t)
+	assertEqual(true, strings.HasPrefix(failure.Message, "Proxy error: "), t)
+}
+
+func Test_request_headers(t *testing.T) {
+	received := make(chan http.Header, 1)
+	url, stop := passing(t, func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header
+	})
+	defer stop()
+
+	request, _ := http.NewRequest("GET", url+"/info", nil)
+	request.Header.Set("Connection", "X-Secret")
+	request.Header.Set("X-Secret", "1")
+	request.Header.Set("Keep-Alive", "timeout=5")
+	request.Header.Set("Via", "1.0 gateway")
+	request.Header.Set("X-Forwarded-For", "10.0.0.1")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	header := <-received
+	assertEqual("", header.Get("X-Secret"), t)
+	assertEqual("", header.Get("Keep-Alive"), t)
+	assertEqual([]string{"1.0 gateway", "1.1 Boot"}, header["Via"], t)
+	assertEqual("10.0.0.1, 127.0.0.1", header.Get("X-Forwarded-For"), t)
+}
+
+func Test_response_headers(t *testing.T) {
+	url, stop := passing(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Connection", "X-Secret")
+		w.Header().Set("X-Secret", "1")
+		w.Header().Set("Keep-Alive", "timeout=5")
+		w.Header().Set("Via", "1.0 daemon")
+		w.Header().Set("Api-Version", "1.41")
+	})
+	defer stop()
+
+	response, err := http.Get(url + "/info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+
+	assertEqual("", response.Header.Get("X-Secret"), t)
+	assertEqual("", response.Header.Get("Keep-Alive"), t)
+	assertEqual([]string{"1.0 daemon", "1.1 Boot"}, response.Header["Via"], t)
+	assertEqual("1.41", response.Header.Get("Api-Version"), t)
+}
+
+// Sends a request over a raw connection to the given URL, returning the
+// connection and the response read from it
+func raw(t *testing.T, url, request string) (net.Conn, *bufio.Reader, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(url, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprint(conn, request)
+	reader := bufio.NewReader(conn)
+	response, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn, reader, response
+}
+
+// Hijacks the connection, replies with the given head and then echoes
+// input in upper case until the client is done sending, saying goodbye
+func echo(head string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, buffered, _ := w.(http.Hijacker).Hijack()
+		defer conn.Close()
+
+		fmt.Fprint(conn, head)
+		input, _ := ioutil.ReadAll(buffered)
+		fmt.Fprintf(conn, "%s bye", strings.ToUpper(string(input)))
+	}
+}
+
+func Test_hijack_upgrade(t *testing.T) {
+	url, stop := passing(t, echo("HTTP/1.1 101 UPGRADED\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n"))
+	defer stop()
+
+	conn, reader, response := raw(t, url, "POST /v1.41/containers/web/attach?stream=1&stdin=1 HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	defer conn.Close()
+	assertEqual(http.StatusSwitchingProtocols, response.StatusCode, t)
+	assertEqual("1.1 Boot", response.Header.Get("Via"), t)
+
+	fmt.Fprint(conn, "hello")
+	conn.(*net.TCPConn).CloseWrite()
+
+	output, _ := ioutil.ReadAll(reader)
+	assertEqual("HELLO bye", string(output), t)
+}
+
+func Test_hijack_raw_stream(t *testing.T) {
+	url, stop := passing(t, echo("HTTP/1.1 200 OK\r\nContent-Type: application/vnd.docker.raw-stream\r\n\r\n"))
+	defer stop()
+
+	conn, reader, response := raw(t, url, "POST /exec/4711/start HTTP/1.1\r\nHost: localhost\r\nContent-Length: 2\r\n\r\n{}")
+	defer conn.Close()
+	assertEqual(http.StatusOK, response.StatusCode, t)
+
+	fmt.Fprint(conn, "ls")
+	conn.(*net.TCPConn).CloseWrite()
+
+	output, _ := ioutil.ReadAll(reader)
+	assertEqual("{}LS bye", string(output), t)
+}
+
+func Test_hijack_not_switched(t *testing.T) {
+	url, stop := passing(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"message": "No such container: web"}`)
+	})
+	defer stop()
+
+	conn, _, response := raw(t, url, "POST /containers/web/attach HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	defer conn.Close()
+	defer response.Body.Close()
+
+	body, _ := ioutil.ReadAll(response.Body)
+	assertEqual(http.StatusNotFound, response.StatusCode, t)
+	assertEqual(`{"message": "No such container: web"}`, string(body), t)
+}
+
+func Test_rewrite_listing(t *testing.T) {
+	daemon := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"Id": "web", "State": "running"}, {"Id": "db", "State": "running"}, {"Id": "cache", "State": "exited"}]`)
+	}))
+	defer daemon.Close()
+	address, _ := addr.Parse(daemon.URL)
+
+	fixture := Pass(address, output.NewStream("", func(arg string) {}))
+	fixture.Rewrite = Filter(func(id string) bool { return id == "db" }, nil).Rewrite
+	server := httptest.NewServer(fixture)
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/v1.41/containers/json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+
+	body, _ := ioutil.ReadAll(response.Body)
+	assertEqual(`[{"Id":"db","State":"running"},{"Id":"cache","State":"exited"}]`, string(body), t)
+	assertEqual(int64(len(body)), response.ContentLength, t)
+}
+
+func Test_rewrite_inspect(t *testing.T) {
+	rewrite := Filter(nil, func(id string) (interface{}, bool) {
+		return map[string]string{"Status": "ready"}, id == "web"
+	}).Rewrite
+
+	for id, expect := range map[string]string{
+		"web": `{"Boot":{"Status":"ready"},"Id":"web"}`,
+		"db":  `{"Id": "db"}`,
+	} {
+		response := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(`{"Id": "` + id + `"}`))}
+		if err := rewrite(httptest.NewRequest("GET", "/containers/"+id+"/json", nil), response); err != nil {
+			t.Fatal(err)
+		}
+
+		body, _ := ioutil.ReadAll(response.Body)
+		assertEqual(expect, string(body), t)
+	}
+}
+
+func Test_rewrite_keeps_invalid(t *testing.T) {
+	rewrite := Filter(func(id string) bool { return false }, nil).Rewrite
+	response := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(`{}`))}
+
+	err := rewrite(httptest.NewRequest("GET", "/containers/json", nil), response)
+	body, _ := ioutil.ReadAll(response.Body)
+	assertEqual(true, err != nil, t)
+	assertEqual(`{}`, string(body), t)
+}
+
+func Test_rewrite_ignores_others(t *testing.T) {
+	rewrite := Filter(nil, nil).Rewrite
+	response := &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(`[]`))}
+
+	assertEqual(nil, rewrite(httptest.NewRequest("GET", "/images/json", nil), response), t)
+	assertEqual(nil, rewrite(httptest.NewRequest("POST", "/containers/json", nil), response), t)
+}
@@ -0,0 +1,175 @@
+package state
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tueftler/boot/output"
+)
+
+const (
+	PENDING = "pending"
+	BOOTING = "booting"
+	READY   = "ready"
+	FAILED  = "failed"
+)
+
+type Container struct {
+	ID       string `json:"Id"`
+	Name     string
+	Status   string
+	Command  string
+	Started  time.Time
+	Duration string
+	Attempts int
+	ExitCode int
+	Reason   string
+	Restarts int
+	Output   []string
+	partial  string
+}
+
+type Registry struct {
+	lock       sync.Mutex
+	containers map[string]*Container
+	lines      int
+}
+
+// Record returns a registry keeping track of each container's boot state,
+// remembering the given number of output lines per container
+func Record(lines int) *Registry {
+	return &Registry{containers: make(map[string]*Container), lines: lines}
+}
+
+// Pending records a container as waiting to be booted, discarding any
+// previous state, e.g. from before it was restarted, except for the
+// number of restarts
+func (r *Registry) Pending(id, name string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	restarts := 0
+	if previous, ok := r.containers[id]; ok {
+		restarts = previous.Restarts
+	}
+
+	r.containers[id] = &Container{
+		ID:       id,
+		Name:     strings.TrimPrefix(name, "/"),
+		Status:   PENDING,
+		Started:  time.Now(),
+		Restarts: restarts,
+		Output:   make([]string, 0),
+	}
+}
+
+// Booting records a container's boot command as running
+func (r *Registry) Booting(id, command string) {
+	r.update(id, func(container *Container) {
+		container.Status = BOOTING
+		container.Command = command
+		container.Started = time.Now()
+	})
+}
+
+// Finish records a container as ready or failed, along with how often
+// the boot command was attempted, its exit code and a reason, if any.
+// Returns how long booting took.
+func (r *Registry) Finish(id, status string, attempts, exitCode int, reason string) time.Duration {
+	var duration time.Duration
+	r.update(id, func(container *Container) {
+		duration = time.Since(container.Started)
+		container.Status = status
+		container.Duration = duration.String()
+		container.Attempts = attempts
+		container.ExitCode = exitCode
+		container.Reason = reason
+	})
+	return duration
+}
+
+// Restart counts a restart of a container and returns how often it has
+// been restarted so far, including this one
+func (r *Registry) Restart(id string) int {
+	restarts := 0
+	r.update(id, func(container *Container) {
+		container.Restarts++
+		restarts = container.Restarts
+	})
+	return restarts
+}
+
+// Forget removes a container, e.g. once it has been destroyed
+func (r *Registry) Forget(id string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.containers, id)
+}
+
+// Output returns a writer recording the container's last output lines
+func (r *Registry) Output(id string) func(string) {
+	return func(text string) {
+		r.update(id, func(container *Container) {
+			lines := strings.Split(container.partial+output.Plain(text), "\n")
+			container.partial = lines[len(lines)-1]
+			container.Output = append(container.Output, lines[0:len(lines)-1]...)
+			if len(container.Output) > r.lines {
+				container.Output = container.Output[len(container.Output)-r.lines:]
+			}
+		})
+	}
+}
+
+// Get returns a copy of a given container's state
+func (r *Registry) Get(id string) (Container, bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if container, ok := r.containers[id]; ok {
+		snapshot := *container
+		snapshot.Output = append([]string{}, container.Output...)
+		return snapshot, true
+	}
+	return Container{}, false
+}
+
+// List returns a copy of all containers' states, ordered by name
+func (r *Registry) List() []Container {
+	r.lock.Lock()
+	ids := make([]string, 0, len(r.containers))
+	for id := range r.containers {
+		ids = append(ids, id)
+	}
+	r.lock.Unlock()
+
+	list := make([]Container, 0, len(ids))
+	for _, id := range ids {
+		if container, ok := r.Get(id); ok {
+			list = append(list, container)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ServeHTTP is the http.Handler implementation
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(r.List())
+}
+
+// Applies a given change to a container, if it is known
+func (r *Registry) update(id string, change func(container *Container)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if container, ok := r.containers[id]; ok {
+		change(container)
+	}
+}
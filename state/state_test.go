@@ -0,0 +1,120 @@
+package state
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/tueftler/boot/output"
+)
+
+const CONTAINER = "610036617aa165161127bc0cec60ae7831fdc1ddf1fdef1fb7f246cc83b0c315"
+
+func assertEqual(expect, actual interface{}, t *testing.T) {
+	if !reflect.DeepEqual(expect, actual) {
+		t.Errorf("Items not equal:\nexpected %q\nhave     %q\n", expect, actual)
+	}
+}
+
+func Test_create(t *testing.T) {
+	Record(10)
+}
+
+func Test_pending(t *testing.T) {
+	fixture := Record(10)
+	fixture.Pending(CONTAINER, "/web")
+
+	container, _ := fixture.Get(CONTAINER)
+	assertEqual(PENDING, container.Status, t)
+	assertEqual("web", container.Name, t)
+}
+
+func Test_unknown(t *testing.T) {
+	_, ok := Record(10).Get(CONTAINER)
+	assertEqual(false, ok, t)
+}
+
+func Test_booting(t *testing.T) {
+	fixture := Record(10)
+	fixture.Pending(CONTAINER, "/web")
+	fixture.Booting(CONTAINER, "Exec{[/boot.sh]}")
+
+	container, _ := fixture.Get(CONTAINER)
+	assertEqual(BOOTING, container.Status, t)
+	assertEqual("Exec{[/boot.sh]}", container.Command, t)
+}
+
+func Test_finish(t *testing.T) {
+	fixture := Record(10)
+	fixture.Pending(CONTAINER, "/web")
+	fixture.Booting(CONTAINER, "Exec{[/boot.sh]}")
+	duration := fixture.Finish(CONTAINER, FAILED, 3, 1, "Non-zero exit code 1")
+
+	container, _ := fixture.Get(CONTAINER)
+	assertEqual(duration.String(), container.Duration, t)
+	assertEqual(FAILED, container.Status, t)
+	assertEqual(3, container.Attempts, t)
+	assertEqual(1, container.ExitCode, t)
+	assertEqual("Non-zero exit code 1", container.Reason, t)
+}
+
+func Test_restart(t *testing.T) {
+	fixture := Record(10)
+	fixture.Pending(CONTAINER, "/web")
+	assertEqual(1, fixture.Restart(CONTAINER), t)
+
+	fixture.Pending(CONTAINER, "/web")
+	assertEqual(2, fixture.Restart(CONTAINER), t)
+
+	container, _ := fixture.Get(CONTAINER)
+	assertEqual(2, container.Restarts, t)
+}
+
+func Test_forget(t *testing.T) {
+	fixture := Record(10)
+	fixture.Pending(CONTAINER, "/web")
+	fixture.Forget(CONTAINER)
+
+	_, ok := fixture.Get(CONTAINER)
+	assertEqual(false, ok, t)
+}
+
+func Test_output(t *testing.T) {
+	fixture := Record(2)
+	fixture.Pending(CONTAINER, "/web")
+
+	stream := output.NewStream("> ", func(arg string) {}).Tee(fixture.Output(CONTAINER))
+	stream.Println("Line 1")
+	stream.Error("Line 2")
+	stream.Printf("Line 3\nLine")
+
+	container, _ := fixture.Get(CONTAINER)
+	assertEqual([]string{"Line 2", "Line 3"}, container.Output, t)
+}
+
+func Test_list(t *testing.T) {
+	fixture := Record(10)
+	fixture.Pending("b"+CONTAINER[1:], "/web")
+	fixture.Pending(CONTAINER, "/db")
+
+	names := make([]string, 0)
+	for _, container := range fixture.List() {
+		names = append(names, container.Name)
+	}
+	assertEqual([]string{"db", "web"}, names, t)
+}
+
+func Test_serve(t *testing.T) {
+	fixture := Record(10)
+	fixture.Pending(CONTAINER, "/web")
+
+	response := httptest.NewRecorder()
+	fixture.ServeHTTP(response, httptest.NewRequest("GET", "/_boot/containers", nil))
+
+	var containers []map[string]interface{}
+	json.Unmarshal(response.Body.Bytes(), &containers)
+	assertEqual("application/json", response.Header().Get("Content-Type"), t)
+	assertEqual(CONTAINER, containers[0]["Id"], t)
+	assertEqual("pending", containers[0]["Status"], t)
+}